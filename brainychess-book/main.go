@@ -0,0 +1,327 @@
+// This file contains the book command, used to audit and maintain polyglot
+// and ABK opening books.
+//
+// Usage:
+//   brainychess-book probe -book a.bin [fen | startpos]
+//   brainychess-book dump -book a.bin [-depth n] [-pgn] [fen | startpos]
+//   brainychess-book merge a.bin b.bin ... -o out.bin [-policy sum|max|priority] [-normalize]
+//   brainychess-book convert a.abk -o out.bin
+
+package main
+
+import (
+  "os"
+  "fmt"
+  "flag"
+  "strings"
+  "github.com/vigneshv59/chessboard/chessboard"
+)
+
+const startFen = "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
+
+func usage() {
+  fmt.Fprintln(os.Stderr, "Usage:")
+  fmt.Fprintln(os.Stderr, "  brainychess-book probe -book a.bin [fen | startpos]")
+  fmt.Fprintln(os.Stderr, "  brainychess-book dump -book a.bin [-depth n] [-pgn] [fen | startpos]")
+  fmt.Fprintln(os.Stderr, "  brainychess-book merge a.bin b.bin ... -o out.bin [-policy sum|max|priority] [-normalize]")
+  fmt.Fprintln(os.Stderr, "  brainychess-book convert a.abk -o out.bin")
+  os.Exit(2)
+}
+
+func fail(err error) {
+  fmt.Fprintln(os.Stderr, err)
+  os.Exit(1)
+}
+
+// Parses flags which may appear anywhere among the arguments, returning the
+// remaining positional arguments.
+func parseArgs(fs *flag.FlagSet, args []string) []string {
+  positional := make([]string, 0, len(args))
+
+  for {
+    fs.Parse(args)
+
+    if fs.NArg() == 0 {
+      return positional
+    }
+
+    positional = append(positional, fs.Arg(0))
+    args = fs.Args()[1:]
+  }
+}
+
+// Loads the books in a ';' separated list of file names.
+func loadBooks(names string) []chessboard.Book {
+  books := make([]chessboard.Book, 0, 2)
+
+  for _, name := range strings.Split(names, ";") {
+    if name == "" {
+      continue
+    }
+
+    book, err := chessboard.LoadBook(name)
+
+    if err != nil {
+      fail(err)
+    }
+
+    books = append(books, book)
+  }
+
+  if len(books) == 0 {
+    usage()
+  }
+
+  return books
+}
+
+// Creates the board described by the positional arguments, which is either a
+// FEN (possibly split over several arguments) or startpos.
+func boardFromArgs(args []string) chessboard.Chessboard {
+  fen := strings.Join(args, " ")
+
+  if fen == "" || fen == "startpos" {
+    fen = startFen
+  }
+
+  board, err := chessboard.NewChessboard(fen)
+
+  if err != nil {
+    fail(err)
+  }
+
+  return board
+}
+
+// Returns the legal entries of the book which have a weight, and their total
+// weight.
+func playableEntries(book chessboard.Book, board chessboard.Chessboard) ([]chessboard.BookEntry, int) {
+  entries := make([]chessboard.BookEntry, 0, 8)
+  total := 0
+
+  for _, e := range book.Probe(board) {
+    if e.Legal && e.Weight > 0 {
+      entries = append(entries, e)
+      total += e.Weight
+    }
+  }
+
+  return entries, total
+}
+
+// Returns the move number prefix of a move played on the board, e.g. "1." or
+// "1...".
+func moveNumber(board chessboard.Chessboard) string {
+  if board.BlackToMove() {
+    return fmt.Sprintf("%d...", board.FullmoveNumber())
+  }
+
+  return fmt.Sprintf("%d.", board.FullmoveNumber())
+}
+
+// Returns the board after playing the move of a book entry.
+func afterMove(board chessboard.Chessboard, e chessboard.BookEntry) chessboard.Chessboard {
+  after := board.Copy()
+  after.MoveAlDescriptive(chessboard.MoveToAl(e.Move))
+
+  return after
+}
+
+func handleProbe(args []string) {
+  fs := flag.NewFlagSet("probe", flag.ExitOnError)
+  names := fs.String("book", "", "The books to probe, separated by ';'.")
+  board := boardFromArgs(parseArgs(fs, args))
+
+  fmt.Printf("Key: %016x\n", board.BookHash())
+
+  for _, book := range loadBooks(*names) {
+    entries := book.Probe(board)
+    total := 0
+
+    for _, e := range entries {
+      if e.Legal {
+        total += e.Weight
+      }
+    }
+
+    fmt.Printf("%s: %d entries\n", book.Name(), len(entries))
+
+    for _, e := range entries {
+      percent := 0.0
+      if e.Legal && total > 0 {
+        percent = 100 * float64(e.Weight) / float64(total)
+      }
+
+      san := e.SAN
+      if !e.Legal {
+        san = "(illegal)"
+      }
+
+      fmt.Printf("  %-10s %-6s weight %5d  learn %4d  %5.1f%%",
+                 san, chessboard.MoveToAl(e.Move), e.Weight, e.Learn, percent)
+
+      if e.Games > 0 || e.Priority > 0 {
+        fmt.Printf("  priority %d  games %d  won %d  lost %d", e.Priority, e.Games, e.Won, e.Lost)
+      }
+
+      fmt.Println()
+    }
+  }
+}
+
+// Prints the book tree from the board as indented text. Positions which have
+// already been printed (transpositions) are not expanded again.
+func dumpText(book chessboard.Book, board chessboard.Chessboard, depth int, indent string, seen map[uint64]bool) {
+  if depth == 0 || seen[board.BookHash()] {
+    return
+  }
+
+  seen[board.BookHash()] = true
+  entries, total := playableEntries(book, board)
+
+  for _, e := range entries {
+    fmt.Printf("%s%s %s (weight %d, %.1f%%, learn %d)\n", indent, moveNumber(board), e.SAN,
+               e.Weight, 100 * float64(e.Weight) / float64(total), e.Learn)
+
+    dumpText(book, afterMove(board, e), depth - 1, indent + "  ", seen)
+  }
+}
+
+// Builds the book tree from the board as a PGN line: the move with the
+// highest weight is the main line, the others are variations.
+func dumpLine(book chessboard.Book, board chessboard.Chessboard, depth int, seen map[uint64]bool) []*chessboard.PGNMove {
+  if depth == 0 || seen[board.BookHash()] {
+    return nil
+  }
+
+  seen[board.BookHash()] = true
+  entries, total := playableEntries(book, board)
+  moves := make([]*chessboard.PGNMove, len(entries))
+
+  for i, e := range entries {
+    moves[i] = &chessboard.PGNMove{
+      SAN: e.SAN,
+      From: e.Move[0],
+      To: e.Move[1],
+      Comments: []string{fmt.Sprintf("weight %d, %.1f%%", e.Weight, 100 * float64(e.Weight) / float64(total))},
+    }
+
+    if len(e.Move) > 2 {
+      moves[i].Promotion = strings.ToUpper(chessboard.MoveToAl(e.Move)[4:])
+    }
+  }
+
+  if len(moves) == 0 {
+    return nil
+  }
+
+  for i, e := range entries[1:] {
+    variation := append([]*chessboard.PGNMove{moves[i + 1]}, dumpLine(book, afterMove(board, e), depth - 1, seen)...)
+    moves[0].Variations = append(moves[0].Variations, variation)
+  }
+
+  return append([]*chessboard.PGNMove{moves[0]}, dumpLine(book, afterMove(board, entries[0]), depth - 1, seen)...)
+}
+
+func handleDump(args []string) {
+  fs := flag.NewFlagSet("dump", flag.ExitOnError)
+  names := fs.String("book", "", "The book to dump.")
+  depth := fs.Int("depth", 10, "The number of plies to dump.")
+  pgn := fs.Bool("pgn", false, "Write the tree as a PGN game with variations.")
+  board := boardFromArgs(parseArgs(fs, args))
+  book := loadBooks(*names)[0]
+
+  if !*pgn {
+    dumpText(book, board, *depth, "", make(map[uint64]bool))
+    return
+  }
+
+  game := chessboard.NewPGNGame()
+  game.SetTag("Event", "Book dump: " + book.Name())
+
+  if fen := board.Fen(); fen != startFen {
+    game.SetTag("SetUp", "1")
+    game.SetTag("FEN", fen)
+  }
+
+  game.Moves = dumpLine(book, board, *depth, make(map[uint64]bool))
+
+  if err := game.WritePGN(os.Stdout); err != nil {
+    fail(err)
+  }
+}
+
+func handleMerge(args []string) {
+  fs := flag.NewFlagSet("merge", flag.ExitOnError)
+  output := fs.String("o", "", "The merged book to write.")
+  policyName := fs.String("policy", "sum", "How weights are combined: sum, max or priority (first book wins).")
+  normalize := fs.Bool("normalize", false, "Scale the weights of each book to the same total per position first.")
+  names := parseArgs(fs, args)
+
+  if *output == "" || len(names) == 0 {
+    usage()
+  }
+
+  policies := map[string]chessboard.BookMergePolicy{
+    "sum": chessboard.BookMergeSum,
+    "max": chessboard.BookMergeMax,
+    "priority": chessboard.BookMergePriority,
+  }
+
+  policy, ok := policies[*policyName]
+  if !ok {
+    usage()
+  }
+
+  writeBook(*output, chessboard.MergeBooks(loadBooks(strings.Join(names, ";")), policy, *normalize))
+}
+
+func handleConvert(args []string) {
+  fs := flag.NewFlagSet("convert", flag.ExitOnError)
+  output := fs.String("o", "", "The polyglot book to write.")
+  names := parseArgs(fs, args)
+
+  if *output == "" || len(names) != 1 {
+    usage()
+  }
+
+  writeBook(*output, loadBooks(names[0])[0].Entries())
+}
+
+// Writes entries as a polyglot book.
+func writeBook(name string, entries []chessboard.Entry) {
+  f, err := os.Create(name)
+
+  if err != nil {
+    fail(err)
+  }
+
+  if err = chessboard.WriteBookEntries(f, entries); err == nil {
+    err = f.Close()
+  }
+
+  if err != nil {
+    fail(err)
+  }
+
+  fmt.Printf("Wrote %d entries to %s\n", len(entries), name)
+}
+
+func main() {
+  if len(os.Args) < 2 {
+    usage()
+  }
+
+  switch os.Args[1] {
+  case "probe":
+    handleProbe(os.Args[2:])
+  case "dump":
+    handleDump(os.Args[2:])
+  case "merge":
+    handleMerge(os.Args[2:])
+  case "convert":
+    handleConvert(os.Args[2:])
+  default:
+    usage()
+  }
+}
@@ -0,0 +1,108 @@
+// This file contains the bookbuild command, which creates a polyglot opening
+// book from one or more PGN files.
+//
+// Usage: brainychess-bookbuild [options] -o book.bin games.pgn ...
+
+package main
+
+import (
+  "os"
+  "io"
+  "fmt"
+  "flag"
+  "strings"
+  "github.com/vigneshv59/chessboard/chessboard"
+)
+
+// Adds every game of a PGN file to the book, returning the number of games
+// read, and the number of those that were skipped.
+func addPGNFile(filename string, builder *chessboard.BookBuilder) (int, int, error) {
+  f, err := os.Open(filename)
+
+  if err != nil {
+    return 0, 0, err
+  }
+
+  defer f.Close()
+
+  reader := chessboard.NewPGNReader(f)
+  read, skipped := 0, 0
+
+  for {
+    game, err := reader.Next()
+
+    if err == io.EOF {
+      return read, skipped, nil
+    }
+
+    if game == nil {
+      return read, skipped, err
+    }
+
+    read += 1
+
+    if err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      skipped += 1
+      continue
+    }
+
+    if !builder.AddGame(game) {
+      skipped += 1
+    }
+  }
+}
+
+func main() {
+  opts := chessboard.DefaultBookBuildOptions()
+
+  output := flag.String("o", "book.bin", "The polyglot book to write.")
+  results := flag.String("results", strings.Join(opts.Results, ","), "Comma separated results of the games to use.")
+  flag.IntVar(&opts.MinElo, "min-elo", opts.MinElo, "Minimum Elo of both players, 0 to use all games.")
+  flag.IntVar(&opts.MaxPly, "max-ply", opts.MaxPly, "Number of plies of each game added to the book.")
+  flag.IntVar(&opts.MinCount, "min-count", opts.MinCount, "Minimum number of times a move must be played.")
+  flag.IntVar(&opts.WinWeight, "win", opts.WinWeight, "Weight of a move played by the winning side.")
+  flag.IntVar(&opts.DrawWeight, "draw", opts.DrawWeight, "Weight of a move played in a drawn game.")
+  flag.IntVar(&opts.LossWeight, "loss", opts.LossWeight, "Weight of a move played by the losing side.")
+  flag.Parse()
+
+  if flag.NArg() == 0 {
+    fmt.Fprintln(os.Stderr, "Usage: brainychess-bookbuild [options] -o book.bin games.pgn ...")
+    flag.PrintDefaults()
+    os.Exit(2)
+  }
+
+  opts.Results = strings.Split(*results, ",")
+  builder := chessboard.NewBookBuilder(opts)
+
+  for _, name := range flag.Args() {
+    read, skipped, err := addPGNFile(name, builder)
+
+    if err != nil {
+      fmt.Fprintln(os.Stderr, err)
+      os.Exit(1)
+    }
+
+    fmt.Printf("%s: %d games read, %d skipped\n", name, read, skipped)
+  }
+
+  f, err := os.Create(*output)
+
+  if err != nil {
+    fmt.Fprintln(os.Stderr, err)
+    os.Exit(1)
+  }
+
+  entries := builder.Entries()
+
+  if err = chessboard.WriteBookEntries(f, entries); err == nil {
+    err = f.Close()
+  }
+
+  if err != nil {
+    fmt.Fprintln(os.Stderr, err)
+    os.Exit(1)
+  }
+
+  fmt.Printf("Wrote %d entries from %d games to %s\n", len(entries), builder.Games(), *output)
+}
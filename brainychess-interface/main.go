@@ -5,6 +5,7 @@
 package main
 
 import (
+  "io"
   "os"
   "fmt"
   "bufio"
@@ -14,9 +15,82 @@ import (
 
 type gameState struct {
   moves []string
+  evals []string // The engine's evaluation after each move, "" for user moves.
   startFen string
 }
 
+// Writes the game played so far to a PGN file.
+func handleSave(filename string, state *gameState) error {
+  game, err := chessboard.NewPGNGameFromMoves(state.startFen, state.moves)
+
+  if err != nil {
+    return err
+  }
+
+  board, _ := chessboard.NewChessboard(state.startFen)
+  game.SetTag("Event", "BrainyEngine Interface Game")
+  game.SetTag("White", "Human")
+  game.SetTag("Black", "BrainyEngine")
+
+  if board.BlackToMove() {
+    game.SetTag("White", "BrainyEngine")
+    game.SetTag("Black", "Human")
+  }
+
+  for i, m := range game.Moves {
+    m.Eval = state.evals[i]
+  }
+
+  f, err := os.Create(filename)
+
+  if err != nil {
+    return err
+  }
+
+  defer f.Close()
+
+  return game.WritePGN(f)
+}
+
+// Loads the first game of a PGN file, returning the position at the end of
+// its main line.
+func handleLoad(filename string, state *gameState) (chessboard.Chessboard, error) {
+  var board chessboard.Chessboard
+
+  f, err := os.Open(filename)
+
+  if err != nil {
+    return board, err
+  }
+
+  defer f.Close()
+
+  game, err := chessboard.NewPGNReader(f).Next()
+
+  if err == io.EOF {
+    return board, fmt.Errorf("No games in %s.", filename)
+  } else if err != nil {
+    return board, err
+  }
+
+  start, err := game.StartingBoard()
+
+  if err != nil {
+    return board, err
+  }
+
+  state.startFen = start.Fen()
+  state.moves = make([]string, 0, 100)
+  state.evals = make([]string, 0, 100)
+
+  for _, m := range game.Moves {
+    state.moves = append(state.moves, chessboard.PosToAl(m.From) + chessboard.PosToAl(m.To) + strings.ToLower(m.Promotion))
+    state.evals = append(state.evals, m.Eval)
+  }
+
+  return game.FinalBoard()
+}
+
 func handlePosition(position string) chessboard.Chessboard {
   board, _ := chessboard.NewChessboard(position)
 
@@ -44,6 +118,52 @@ func handleInterfaceInput(input string,
     }
 
     b = handlePosition(fen)
+    state.startFen = fen
+    state.moves = state.moves[:0]
+    state.evals = state.evals[:0]
+  case "book":
+    books := make([]chessboard.Book, 0, len(cmdArr))
+
+    for _, name := range cmdArr[1:] {
+      book, err := chessboard.LoadBook(name)
+
+      if err != nil {
+        fmt.Println(err)
+        continue
+      }
+
+      books = append(books, book)
+    }
+
+    chessboard.SetDefaultBooks(books...)
+    b.SetBooks(books...)
+  case "save":
+    if len(cmdArr) != 2 {
+      fmt.Println("Incorrect arguments.")
+
+      break
+    }
+
+    if err := handleSave(cmdArr[1], state); err != nil {
+      fmt.Println(err)
+    }
+  case "load":
+    if len(cmdArr) != 2 {
+      fmt.Println("Incorrect arguments.")
+
+      break
+    }
+
+    board, err := handleLoad(cmdArr[1], state)
+
+    if err != nil {
+      fmt.Println(err)
+
+      break
+    }
+
+    b = board
+    b.PrintBoard()
   default:
     if len(cmdArr) == 0 || cmdArr[0] == "" {
       return b
@@ -56,21 +176,26 @@ func handleInterfaceInput(input string,
       break
     }
 
+    state.moves = append(state.moves, cmdArr[0])
+    state.evals = append(state.evals, "")
+
     depth := 4
     b.PrintBoard()
 
-    a := false
-    _, move := b.AlphaBeta(depth, &a)
+    score, move := b.AlphaBeta(chessboard.SearchLimits{Depth: depth})
 
     if len(move) < 2 {
         fmt.Println("Game Over.")
         return b
     }
 
-    moveStr := chessboard.PosToAl(move[0]) + chessboard.PosToAl(move[1])
+    moveStr := chessboard.MoveToAl(move)
     fmt.Println("Engine Moved: " + moveStr)
     b.MoveAlDescriptive(moveStr)
 
+    state.moves = append(state.moves, moveStr)
+    state.evals = append(state.evals, chessboard.FormatPGNEval(score))
+
     b.PrintBoard()
   }
 
@@ -79,15 +204,18 @@ func handleInterfaceInput(input string,
 
 func main() {
   fmt.Println("BrainyEngine Interface by Vignesh Varadarajan v0.0")
-  state := gameState{make([]string, 0, 100), "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"}
+  state := gameState{make([]string, 0, 100), make([]string, 0, 100),
+                     "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"}
   var board chessboard.Chessboard
 
-  for {
+  buf := bufio.NewReader(os.Stdin)
 
-    buf := bufio.NewReader(os.Stdin)
+  for {
     sentence, err := buf.ReadBytes('\n')
 
-    if err != nil {
+    if err == io.EOF {
+      return
+    } else if err != nil {
       fmt.Println(err)
     } else {
       board = handleInterfaceInput(strings.TrimSpace(string(sentence)),
@@ -5,22 +5,58 @@
 package main
 
 import (
+  "context"
+  "io"
   "os"
   "fmt"
   "bufio"
   "strings"
   "regexp"
   "strconv"
+  "sync/atomic"
+  "time"
   "github.com/vigneshv59/chessboard/chessboard"
 )
 
 type uciConfig struct {
   debug bool
+  ownBook bool
+  bookFile string // Book file names separated by ';', in priority order.
+  bookLearning bool
+  bookLearnWeights bool
+  bookPolicy chessboard.BookPolicy
+  bookTemperature int // In percent, 100 plays moves in proportion to their weights.
+  learner *chessboard.BookLearner // Records the engine's book moves, nil without learning.
+  moveOverhead int // Milliseconds kept in reserve on every move for communication delays.
+  ponder bool // Send the expected reply with the best move, for the GUI to ponder on.
+  multiPV int // The number of best lines searched and reported.
+  searcher chessboard.Searcher
+  cancel context.CancelFunc // Stops the running search, nil before the first search.
+
+  // Set (atomically) while a "go ponder" search has not had a ponderhit,
+  // and the time manager of that search, to be started on ponderhit.
+  pondering int32
+  ponderTime *chessboard.TimeManager
 }
 
 func handleUci() {
   fmt.Println("id name BrainyEngine 1.0")
   fmt.Println("id author Vignesh")
+  fmt.Println("option name Hash type spin default 16 min 1 max 4096")
+  fmt.Println("option name Clear Hash type button")
+  fmt.Println("option name Threads type spin default 1 min 1 max 256")
+  fmt.Println("option name Move Overhead type spin default 30 min 0 max 5000")
+  fmt.Println("option name Ponder type check default false")
+  fmt.Println("option name MultiPV type spin default 1 min 1 max 256")
+  printSearchOptions()
+  fmt.Println("option name OwnBook type check default true")
+  fmt.Println("option name BookFile type string default <empty>")
+  fmt.Println("option name BookLearning type check default false")
+  fmt.Println("option name BookLearnWeights type check default false")
+  fmt.Println("option name BookPolicy type combo default weighted var best var weighted var temperature")
+  fmt.Println("option name BookTemperature type spin default 100 min 1 max 1000")
+  fmt.Println("option name BookDepth type spin default 0 min 0 max 400")
+  fmt.Println("option name BookSeed type spin default 0 min 0 max 2147483647")
   fmt.Println("uciok")
 }
 
@@ -28,12 +64,251 @@ func (ec *uciConfig) setDebug(desiredState bool) {
   ec.debug = desiredState
 }
 
+// Handles "setoption name <id> [value <x>]". Option names and values may
+// contain spaces.
+func (ec *uciConfig) setOption(cmdArr []string) {
+  name, value := "", ""
+
+  for i, v := range cmdArr {
+    if v == "value" {
+      value = strings.Join(cmdArr[(i+1):], " ")
+      break
+    }
+
+    if i > 1 {
+      name = strings.TrimSpace(name + " " + v)
+    }
+  }
+
+  if setSearchOption(name, value) {
+    return
+  }
+
+  switch strings.ToLower(name) {
+  case "hash":
+    if mb, err := strconv.Atoi(value); err == nil && mb > 0 {
+      chessboard.SetHashSize(mb)
+    }
+
+    return
+  case "clear hash":
+    ec.searcher.ClearHash()
+
+    return
+  case "threads":
+    if n, err := strconv.Atoi(value); err == nil && n >= 1 {
+      ec.searcher.Threads = n
+    }
+
+    return
+  case "ponder":
+    ec.ponder = value == "true"
+
+    return
+  case "multipv":
+    if n, err := strconv.Atoi(value); err == nil && n >= 1 {
+      ec.multiPV = n
+    }
+
+    return
+  case "move overhead":
+    if ms, err := strconv.Atoi(value); err == nil && ms >= 0 {
+      ec.moveOverhead = ms
+    }
+
+    return
+  case "ownbook":
+    ec.ownBook = value == "true"
+  case "bookfile":
+    if value == "<empty>" {
+      value = ""
+    }
+
+    ec.bookFile = value
+  case "booklearning":
+    ec.bookLearning = value == "true"
+    ec.learner = nil
+
+    if ec.bookLearning {
+      ec.learner = chessboard.NewBookLearner()
+      ec.learner.UpdateWeights = ec.bookLearnWeights
+    }
+  case "booklearnweights":
+    ec.bookLearnWeights = value == "true"
+
+    if ec.learner != nil {
+      ec.learner.UpdateWeights = ec.bookLearnWeights
+    }
+
+    return
+  case "bookpolicy":
+    policies := map[string]chessboard.BookPolicy{
+      "best": chessboard.BookBest,
+      "weighted": chessboard.BookWeighted,
+      "temperature": chessboard.BookTemperature,
+    }
+
+    if policy, ok := policies[strings.ToLower(value)]; ok {
+      ec.bookPolicy = policy
+      chessboard.SetBookPolicy(ec.bookPolicy, float64(ec.bookTemperature) / 100)
+    }
+
+    return
+  case "booktemperature":
+    if t, err := strconv.Atoi(value); err == nil && t > 0 {
+      ec.bookTemperature = t
+      chessboard.SetBookPolicy(ec.bookPolicy, float64(ec.bookTemperature) / 100)
+    }
+
+    return
+  case "bookdepth":
+    if plies, err := strconv.Atoi(value); err == nil {
+      chessboard.SetBookMaxPly(plies)
+    }
+
+    return
+  case "bookseed":
+    // A seed of 0 keeps the time based seed, so that games vary.
+    if seed, err := strconv.ParseInt(value, 10, 64); err == nil && seed != 0 {
+      chessboard.SeedBook(seed)
+    }
+
+    return
+  default:
+    fmt.Println("info string Unknown option " + name)
+    return
+  }
+
+  ec.loadBooks()
+}
+
+// An option setting one of the search parameters. Check options have a
+// bool field, spin options an int field between min and max.
+type searchOption struct {
+  name string
+  check func(p *chessboard.SearchParams) *bool
+  spin func(p *chessboard.SearchParams) *int
+  min int
+  max int
+}
+
+// The options of the search, so that each technique can be switched off or
+// tuned to measure its strength.
+var searchOptions = []searchOption{
+  {name: "QuiescenceChecks", check: func(p *chessboard.SearchParams) *bool { return &p.QuiescenceChecks }},
+  {name: "AspirationWindow", spin: func(p *chessboard.SearchParams) *int { return &p.AspirationWindow }, max: 1000},
+  {name: "NullMove", check: func(p *chessboard.SearchParams) *bool { return &p.NullMove }},
+  {name: "NullMoveReduction", spin: func(p *chessboard.SearchParams) *int { return &p.NullMoveReduction }, max: 6},
+  {name: "NullMoveVerification", check: func(p *chessboard.SearchParams) *bool { return &p.NullMoveVerification }},
+  {name: "LMR", check: func(p *chessboard.SearchParams) *bool { return &p.LateMoveReductions }},
+  {name: "LMRMinDepth", spin: func(p *chessboard.SearchParams) *int { return &p.LMRMinDepth }, max: 64},
+  {name: "LMRMoveCount", spin: func(p *chessboard.SearchParams) *int { return &p.LMRMoveCount }, max: 64},
+  {name: "Futility", check: func(p *chessboard.SearchParams) *bool { return &p.Futility }},
+  {name: "FutilityDepth", spin: func(p *chessboard.SearchParams) *int { return &p.FutilityDepth }, max: 10},
+  {name: "FutilityMargin", spin: func(p *chessboard.SearchParams) *int { return &p.FutilityMargin }, max: 1000},
+  {name: "ReverseFutility", check: func(p *chessboard.SearchParams) *bool { return &p.ReverseFutility }},
+  {name: "ReverseFutilityDepth", spin: func(p *chessboard.SearchParams) *int { return &p.ReverseFutilityDepth }, max: 10},
+  {name: "ReverseFutilityMargin", spin: func(p *chessboard.SearchParams) *int { return &p.ReverseFutilityMargin }, max: 1000},
+  {name: "Razoring", check: func(p *chessboard.SearchParams) *bool { return &p.Razoring }},
+  {name: "RazorDepth", spin: func(p *chessboard.SearchParams) *int { return &p.RazorDepth }, max: 10},
+  {name: "RazorMargin", spin: func(p *chessboard.SearchParams) *int { return &p.RazorMargin }, max: 2000},
+  {name: "LMP", check: func(p *chessboard.SearchParams) *bool { return &p.LateMovePruning }},
+  {name: "LMPDepth", spin: func(p *chessboard.SearchParams) *int { return &p.LMPDepth }, max: 10},
+  {name: "LMPMoveCount", spin: func(p *chessboard.SearchParams) *int { return &p.LMPMoveCount }, max: 64},
+  {name: "CheckExtension", check: func(p *chessboard.SearchParams) *bool { return &p.CheckExtension }},
+  {name: "PassedPawnExtension", check: func(p *chessboard.SearchParams) *bool { return &p.PassedPawnExtension }},
+  {name: "Contempt", spin: func(p *chessboard.SearchParams) *int { return &p.Contempt }, min: -100, max: 100},
+}
+
+// Prints the search options, with the engine's default parameters.
+func printSearchOptions() {
+  defaults := chessboard.DefaultSearchParams()
+
+  for _, o := range searchOptions {
+    if o.check != nil {
+      fmt.Printf("option name %s type check default %t\n", o.name, *o.check(&defaults))
+    } else {
+      fmt.Printf("option name %s type spin default %d min %d max %d\n", o.name, *o.spin(&defaults), o.min, o.max)
+    }
+  }
+}
+
+// Sets a search option, returns false if name is not one.
+func setSearchOption(name string, value string) bool {
+  for _, o := range searchOptions {
+    if !strings.EqualFold(o.name, name) {
+      continue
+    }
+
+    params := chessboard.CurrentSearchParams()
+
+    if o.check != nil {
+      *o.check(&params) = value == "true"
+    } else if n, err := strconv.Atoi(value); err == nil && n >= o.min && n <= o.max {
+      *o.spin(&params) = n
+    }
+
+    chessboard.SetSearchParams(params)
+    return true
+  }
+
+  return false
+}
+
+// Loads the configured books, which are shared by every board.
+func (ec *uciConfig) loadBooks() {
+  books := make([]chessboard.Book, 0, 2)
+
+  if ec.ownBook {
+    for _, name := range strings.Split(ec.bookFile, ";") {
+      if name = strings.TrimSpace(name); name == "" {
+        continue
+      }
+
+      // With learning, polyglot books are loaded from (and saved to) a
+      // writable copy next to the original. ABK books do not learn.
+      abk := strings.HasSuffix(strings.ToLower(name), ".abk")
+      learnFile := name + ".learn"
+      if _, err := os.Stat(learnFile); ec.bookLearning && !abk && err == nil {
+        name = learnFile
+      }
+
+      book, err := chessboard.LoadBook(name)
+
+      if err != nil {
+        fmt.Println("info string Could not load book: " + err.Error())
+        continue
+      }
+
+      if pb, ok := book.(*chessboard.OpeningBook); ok && ec.bookLearning {
+        pb.SetLearnFile(learnFile)
+      }
+
+      books = append(books, book)
+    }
+  }
+
+  chessboard.SetDefaultBooks(books...)
+}
+
 func handleIsReady() {
   fmt.Println("readyok")
 }
 
-func handleNewGame() {
-  // TODO: Clear chessboard and initialize new game
+// Learns from the game which has just finished, if book learning is on.
+func (ec *uciConfig) learnFromGame() {
+  if ec.learner == nil {
+    return
+  }
+
+  if err := ec.learner.Learn(ec.learner.Result()); err != nil {
+    fmt.Println("info string Could not save book: " + err.Error())
+  }
+}
+
+func handleNewGame(ec *uciConfig) {
+  ec.learnFromGame()
+  ec.searcher.ClearHash()
 }
 
 func handlePosition(position string) chessboard.Chessboard {
@@ -42,18 +317,166 @@ func handlePosition(position string) chessboard.Chessboard {
   return board
 }
 
+// The parameters of a "go" command. Times are in milliseconds, and 0 for
+// parameters which were not given.
+type goParams struct {
+  searchMoves []string
+  ponder bool
+  wtime, btime int
+  winc, binc int
+  movesToGo int
+  depth int
+  nodes int
+  mate int
+  moveTime int
+  infinite bool
+}
+
+// Parses the parameters of a "go" command. Unknown tokens and invalid
+// numbers are ignored.
+func parseGo(args []string) goParams {
+  var p goParams
+
+  ints := map[string]*int{
+    "wtime": &p.wtime,
+    "btime": &p.btime,
+    "winc": &p.winc,
+    "binc": &p.binc,
+    "movestogo": &p.movesToGo,
+    "depth": &p.depth,
+    "nodes": &p.nodes,
+    "mate": &p.mate,
+    "movetime": &p.moveTime,
+  }
+
+  for i := 0; i < len(args); i++ {
+    switch arg := args[i]; arg {
+    case "ponder":
+      p.ponder = true
+    case "infinite":
+      p.infinite = true
+    case "searchmoves":
+      // The moves run until the next parameter.
+      for i + 1 < len(args) && ints[args[i + 1]] == nil && args[i + 1] != "ponder" && args[i + 1] != "infinite" {
+        i += 1
+        p.searchMoves = append(p.searchMoves, args[i])
+      }
+    default:
+      if v, ok := ints[arg]; ok && i + 1 < len(args) {
+        i += 1
+        *v, _ = strconv.Atoi(args[i])
+      }
+    }
+  }
+
+  return p
+}
+
+// Returns the time manager of a search with the given parameters, nil if
+// the search is not timed.
+func (ec *uciConfig) timeManager(p goParams, black bool, start time.Time) *chessboard.TimeManager {
+  if p.infinite {
+    return nil
+  }
+
+  ms := time.Millisecond
+  tc := chessboard.TimeControl{
+    Time: time.Duration(p.wtime) * ms,
+    Increment: time.Duration(p.winc) * ms,
+    MovesToGo: p.movesToGo,
+    MoveTime: time.Duration(p.moveTime) * ms,
+    Overhead: time.Duration(ec.moveOverhead) * ms,
+  }
+
+  if black {
+    tc.Time = time.Duration(p.btime) * ms
+    tc.Increment = time.Duration(p.binc) * ms
+  }
+
+  if tc.Time == 0 && tc.MoveTime == 0 {
+    return nil
+  }
+
+  tm := chessboard.NewTimeManager(tc, start)
+  if p.ponder {
+    tm.Ponder()
+  }
+
+  return tm
+}
+
+// The default depth of the bench command.
+const benchDepth = 6
+
+// The positions searched by the bench command: the opening, middlegames with
+// tactics, and endings.
+var benchPositions = []string{
+  "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1",
+  "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+  "r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4",
+  "r4rk1/1pp1qppp/p1np1n2/2b1p1B1/2B1P1b1/P1NP1N2/1PP1QPPP/R4RK1 w - - 0 10",
+  "2r3k1/pp3ppp/2n1b3/q2pP3/3P4/P1P2N2/2Q2PPP/R4RK1 b - - 0 18",
+  "8/2p5/3p4/KP5r/1R3p1k/8/4P1P1/8 w - - 0 1",
+  "8/8/4k3/3p4/3P4/4K3/8/8 w - - 0 1",
+  "6k1/5ppp/8/8/8/8/5PPP/3R2K1 w - - 0 1",
+}
+
+// Searches the bench positions to the given depth with an empty hash and
+// no books, and reports the total number of nodes. With a single thread, the
+// node count is a signature of the search: it only changes when the search
+// does.
+func bench(searcher *chessboard.Searcher, depth int) {
+  nodes := 0
+  start := time.Now()
+
+  for _, fen := range benchPositions {
+    board, err := chessboard.NewChessboard(fen)
+    if err != nil {
+      continue
+    }
+
+    board.SetBooks()
+    searcher.ClearHash()
+
+    result := searcher.Search(context.Background(), board, chessboard.SearchLimits{Depth: depth})
+    nodes += result.Stats.Nodes
+  }
+
+  elapsed := time.Since(start)
+
+  fmt.Println("===========================")
+  fmt.Printf("Total time (ms) : %d\n", elapsed.Milliseconds())
+  fmt.Printf("Nodes searched  : %d\n", nodes)
+  fmt.Printf("Nodes/second    : %d\n", int(float64(nodes) / elapsed.Seconds()))
+}
+
+// Stops the running search, if any.
+func (ec *uciConfig) stopSearch() {
+  if ec.cancel != nil {
+    ec.cancel()
+  }
+}
+
 func handleInput(input string,
                   engineConfig *uciConfig,
-                  b *chessboard.Chessboard,
-                  s *bool) {
-  cmdArr := strings.Split(input, " ")
+                  b *chessboard.Chessboard) {
+  // The clock starts as soon as the command is read.
+  start := time.Now()
+  cmdArr := strings.Fields(input)
+
+  if len(cmdArr) == 0 {
+    return
+  }
 
   switch cmdArr[0] {
   case "uci":
     handleUci()
   case "isready":
     handleIsReady()
+  case "ucinewgame":
+    handleNewGame(engineConfig)
   case "quit":
+    engineConfig.learnFromGame()
     os.Exit(0)
   case "seval":
     fmt.Println(b.Evaluate())
@@ -65,6 +488,14 @@ func handleInput(input string,
     }
 
     engineConfig.setDebug(debugState)
+  case "setoption":
+    if len(cmdArr) < 3 || cmdArr[1] != "name" {
+      fmt.Println("Incorrect arguments.")
+
+      break
+    }
+
+    engineConfig.setOption(cmdArr)
   case "position":
     fen := "rnbqkbnr/pppppppp/8/8/8/8/PPPPPPPP/RNBQKBNR w KQkq - 0 1"
 
@@ -80,7 +511,7 @@ func handleInput(input string,
       return
     }
 
-    *s = true
+    engineConfig.stopSearch()
     *b = handlePosition(fen)
 
     for i, v := range cmdArr {
@@ -98,25 +529,90 @@ func handleInput(input string,
         break
       }
     }
-    *s = false
   case "go":
-    depth := 4
-    if len(cmdArr) == 3 {
-      depth, _ = strconv.Atoi(cmdArr[2])
+    params := parseGo(cmdArr[1:])
+    board := b.Copy()
+    limits := chessboard.SearchLimits{
+      Depth: params.depth,
+      Nodes: params.nodes,
+      Mate: params.mate,
+      Time: engineConfig.timeManager(params, board.BlackToMove(), start),
+      SearchMoves: params.searchMoves,
+      MultiPV: engineConfig.multiPV,
     }
 
-    if len(cmdArr) == 2 {
-      depth = 10000
+    // A ponder search runs on the opponent's time, until ponderhit turns it
+    // into a normal search or stop ends it.
+    engineConfig.ponderTime = limits.Time
+    atomic.StoreInt32(&engineConfig.pondering, 0)
+    if params.ponder {
+      atomic.StoreInt32(&engineConfig.pondering, 1)
     }
 
+    ctx, cancel := context.WithCancel(context.Background())
+    engineConfig.cancel = cancel
+    searcher := &engineConfig.searcher
+
     go func ()  {
-      *s = false
-      _, move := b.AlphaBeta(depth, s)
-      fmt.Println("bestmove " + chessboard.PosToAl(move[0]) + chessboard.PosToAl(move[1]))
-      *s = false
+      defer cancel()
+      result := searcher.Search(ctx, board, limits)
+
+      if result.Book {
+        fmt.Println("info string book move " + chessboard.MoveToAl(result.Move))
+      }
+
+      // The move of a ponder search cannot be sent before the GUI says
+      // whether the opponent played the expected move, and the move of an
+      // infinite search not before the GUI stops it.
+      for (atomic.LoadInt32(&engineConfig.pondering) == 1 || params.infinite) && ctx.Err() == nil {
+        time.Sleep(5 * time.Millisecond)
+      }
+
+      ponderMiss := atomic.SwapInt32(&engineConfig.pondering, 0) == 1
+
+      if engineConfig.debug {
+        stats := result.Stats
+        fmt.Printf("info string nodes %d cutoffs %d first move cutoffs %.1f%%\n",
+                   stats.Nodes, stats.Cutoffs, stats.FirstMoveCutoffRate())
+      }
+
+      // There is no move to play when the game is over.
+      bestmove := "bestmove (none)"
+      if result.Move != nil {
+        bestmove = "bestmove " + chessboard.MoveToAl(result.Move)
+      }
+
+      if engineConfig.ponder && len(result.PV) > 1 {
+        bestmove += " ponder " + chessboard.MoveToAl(result.PV[1])
+      }
+
+      fmt.Println(bestmove)
+
+      // The position of a ponder search which was stopped is not the
+      // position of the game.
+      if ponderMiss {
+        return
+      }
+
+      if engineConfig.learner != nil && len(result.Move) >= 2 {
+        engineConfig.learner.RecordMove(board, result.Move, result.Score)
+      }
     }()
   case "stop":
-    *s = true
+    engineConfig.stopSearch()
+  case "ponderhit":
+    if atomic.SwapInt32(&engineConfig.pondering, 0) == 1 && engineConfig.ponderTime != nil {
+      engineConfig.ponderTime.PonderHit()
+    }
+  case "bench":
+    depth := benchDepth
+    if len(cmdArr) > 1 {
+      if d, err := strconv.Atoi(cmdArr[1]); err == nil && d > 0 {
+        depth = d
+      }
+    }
+
+    bench(&engineConfig.searcher, depth)
   case "dump":
     if !engineConfig.debug {
       fmt.Println("Unknown command.")
@@ -136,17 +632,24 @@ func handleInput(input string,
 func main() {
   fmt.Println("BrainyEngine by Vignesh Varadarajan v0.0")
 
-  engineConfig := uciConfig{false}
+  engineConfig := uciConfig{
+    ownBook: true,
+    bookPolicy: chessboard.BookWeighted,
+    bookTemperature: 100,
+    moveOverhead: 30,
+    multiPV: 1,
+    searcher: chessboard.Searcher{Info: chessboard.PrintInfo},
+  }
   var board chessboard.Chessboard
-  b := false
-  stopped := &b
 
-  for {
+  buf := bufio.NewReader(os.Stdin)
 
-    buf := bufio.NewReader(os.Stdin)
+  for {
     sentence, err := buf.ReadBytes('\n')
 
-    if err != nil {
+    if err == io.EOF {
+      return
+    } else if err != nil {
       fmt.Println(err)
     } else {
       m, _ := regexp.MatchString("isready", string(sentence))
@@ -156,7 +659,7 @@ func main() {
       } else {
         handleInput(strings.TrimSpace(string(sentence)),
                 &engineConfig,
-                &board, stopped)
+                &board)
       }
     }
 
@@ -0,0 +1,84 @@
+package main
+
+import (
+  "bufio"
+  "os"
+  "strings"
+  "testing"
+  "time"
+  "github.com/vigneshv59/chessboard/chessboard"
+)
+
+// Runs the commands with the standard output sent to the returned channel,
+// one line at a time. The output is restored when the test ends.
+func runCommands(t *testing.T, engineConfig *uciConfig, b *chessboard.Chessboard, commands ...string) <-chan string {
+  r, w, err := os.Pipe()
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  stdout := os.Stdout
+  os.Stdout = w
+
+  t.Cleanup(func() {
+    os.Stdout = stdout
+    w.Close()
+  })
+
+  lines := make(chan string, 1024)
+
+  go func() {
+    scanner := bufio.NewScanner(r)
+
+    for scanner.Scan() {
+      lines <- scanner.Text()
+    }
+  }()
+
+  for _, command := range commands {
+    handleInput(command, engineConfig, b)
+  }
+
+  return lines
+}
+
+// Waits for a bestmove line, for at most the given time.
+func waitBestMove(lines <-chan string, wait time.Duration) (string, bool) {
+  timeout := time.After(wait)
+
+  for {
+    select {
+    case line := <-lines:
+      if strings.HasPrefix(line, "bestmove") {
+        return line, true
+      }
+    case <-timeout:
+      return "", false
+    }
+  }
+}
+
+// An infinite search only sends its move once the GUI stops it, even when
+// it has nothing left to search.
+func TestGoInfiniteWaitsForStop(t *testing.T) {
+  engineConfig := uciConfig{multiPV: 1}
+  var b chessboard.Chessboard
+
+  // A mate in 1, which the search finds straight away.
+  lines := runCommands(t, &engineConfig, &b, "position fen 6k1/5ppp/8/8/8/8/5PPP/3R2K1 w - - 0 1", "go infinite")
+
+  if line, ok := waitBestMove(lines, 500 * time.Millisecond); ok {
+    t.Fatalf("%q before stop", line)
+  }
+
+  handleInput("stop", &engineConfig, &b)
+
+  line, ok := waitBestMove(lines, 5 * time.Second)
+  if !ok {
+    t.Fatal("no bestmove after stop")
+  }
+
+  if line != "bestmove d1d8" {
+    t.Errorf("%q, want bestmove d1d8", line)
+  }
+}
@@ -0,0 +1,188 @@
+package chessboard
+
+// Reads Arena's ABK opening books. An ABK book is a tree of moves rather than
+// a table of positions: each entry links to its first reply and to the next
+// alternative to it. The tree is walked once when the book is loaded, and
+// the moves are indexed by the polyglot hash of the position they are played
+// in, so that transpositions are found like in polyglot books.
+import (
+  "encoding/binary"
+  "errors"
+  "io/ioutil"
+  "sort"
+)
+
+const (
+  abkEntrySize = 28
+  abkRoot = 900 // The index of the first move from the starting position.
+)
+
+// Promotion pieces of ABK moves, indexed by the absolute value of the
+// promotion field (negative for black).
+var abkPromotions = []string{"", "R", "N", "B", "Q"}
+
+// A move of an ABK book along with its statistics.
+type abkMove struct {
+  move []int
+  encoded uint16 // The move in polyglot encoding.
+  priority int
+  games int
+  won int
+  lost int
+}
+
+// Returns the weight of the move: two points for each game won and one for
+// each game drawn, as the polyglot book builder does. Moves which have never
+// been played in a game are weighted by their priority instead.
+func (m *abkMove) weight() int {
+  if m.games == 0 {
+    return m.priority
+  }
+
+  draws := m.games - m.won - m.lost
+  if draws < 0 {
+    draws = 0
+  }
+
+  return 2 * m.won + draws
+}
+
+// An Arena opening book, loaded into memory.
+type ABKBook struct {
+  name string
+  positions map[uint64][]abkMove
+}
+
+// Loads the ABK book with the given file name into memory.
+func NewABKBook(name string) (*ABKBook, error) {
+  data, err := ioutil.ReadFile(name)
+
+  if err != nil {
+    return nil, err
+  }
+
+  if len(data) < (abkRoot + 1) * abkEntrySize || len(data) % abkEntrySize != 0 {
+    return nil, errors.New("The book " + name + " is not an ABK book.")
+  }
+
+  b := &ABKBook{name: name, positions: make(map[uint64][]abkMove)}
+  board, _ := NewChessboard(startFen)
+  visited := make([]bool, len(data) / abkEntrySize)
+
+  b.walk(data, board, abkRoot, visited)
+
+  return b, nil
+}
+
+// Adds the moves of the entry at index and its siblings, which are all
+// played in the position c, and recursively their replies.
+func (b *ABKBook) walk(data []byte, c Chessboard, index int, visited []bool) {
+  hash := c.BookHash()
+
+  for index >= 0 && index < len(visited) && !visited[index] {
+    visited[index] = true
+    d := data[index * abkEntrySize : (index + 1) * abkEntrySize]
+
+    // ABK squares are numbered from a1 to h8.
+    from := posFromRowColumn(7 - int(d[0]) / 8, int(d[0]) % 8)
+    to := posFromRowColumn(7 - int(d[1]) / 8, int(d[1]) % 8)
+    promo := int(int8(d[2]))
+
+    if promo < 0 {
+      promo = -promo
+    }
+
+    promopiece := ""
+    if promo < len(abkPromotions) {
+      promopiece = abkPromotions[promo]
+    }
+
+    child := int(int32(binary.LittleEndian.Uint32(d[20:24])))
+    index = int(int32(binary.LittleEndian.Uint32(d[24:28])))
+
+    if d[0] > 63 || d[1] > 63 || !c.moveIsLegal(from, to, promopiece) {
+      continue
+    }
+
+    m := abkMove{
+      move: []int{from, to},
+      encoded: c.encodeBookMove(from, to, promopiece),
+      priority: int(d[3]),
+      games: int(binary.LittleEndian.Uint32(d[4:8])),
+      won: int(binary.LittleEndian.Uint32(d[8:12])),
+      lost: int(binary.LittleEndian.Uint32(d[12:16])),
+    }
+
+    if promopiece != "" {
+      m.move = append(m.move, int(pieceVals[promopiece]))
+    }
+
+    // A position reached through a transposition only keeps the moves
+    // which have not already been found.
+    known := false
+    for _, other := range b.positions[hash] {
+      known = known || other.encoded == m.encoded
+    }
+
+    if !known {
+      b.positions[hash] = append(b.positions[hash], m)
+    }
+
+    if child >= 0 {
+      next := c.Copy()
+      next.MakeMove(from, to, promopiece)
+
+      b.walk(data, next, child, visited)
+    }
+  }
+}
+
+// Returns the file name the book was loaded from.
+func (b *ABKBook) Name() string {
+  return b.name
+}
+
+// Returns every move of the book for the given position, sorted by
+// descending weight.
+func (b *ABKBook) Probe(c Chessboard) []BookEntry {
+  moves := b.positions[c.BookHash()]
+  probed := make([]BookEntry, 0, len(moves))
+
+  for _, m := range moves {
+    entry := BookEntry{
+      Move: m.move,
+      Weight: m.weight(),
+      Priority: m.priority,
+      Games: m.games,
+      Won: m.won,
+      Lost: m.lost,
+    }
+
+    if entry.Legal = c.moveIsLegal(m.move[0], m.move[1], ""); entry.Legal {
+      entry.SAN = c.SAN(m.move[0], m.move[1], promoPieceString(m.move))
+    }
+
+    probed = append(probed, entry)
+  }
+
+  sort.SliceStable(probed, func(i, j int) bool {
+    return probed[i].Weight > probed[j].Weight
+  })
+
+  return probed
+}
+
+// Returns the moves of the book as polyglot entries, which can be written
+// with WriteBookEntries to convert the book. Moves without any weight are
+// left out, as polyglot books cannot hold them.
+func (b *ABKBook) Entries() []Entry {
+  weights := make(map[bookKey]int)
+
+  for hash, moves := range b.positions {
+    for _, m := range moves {
+      weights[bookKey{hash, m.encoded}] = m.weight()
+    }
+  }
+
+  return entriesFromWeights(weights, nil)
+}
@@ -0,0 +1,201 @@
+package chessboard
+
+import (
+  "encoding/binary"
+  "io/ioutil"
+  "path/filepath"
+  "testing"
+)
+
+// An entry of an ABK book. Child and sibling are entry indices, -1 for
+// none.
+type abkTestEntry struct {
+  index int
+  from, to string
+  promo int8
+  priority, games, won, lost int
+  child, sibling int
+}
+
+// Encodes the entries in an ABK book of the given number of entries.
+func abkData(size int, entries []abkTestEntry) []byte {
+  data := make([]byte, size * abkEntrySize)
+
+  // ABK squares are numbered from a1 to h8.
+  square := func(al string) byte {
+    return al[0] - 'a' + 8 * (al[1] - '1')
+  }
+
+  for _, e := range entries {
+    d := data[e.index * abkEntrySize : (e.index + 1) * abkEntrySize]
+
+    d[0], d[1], d[2], d[3] = square(e.from), square(e.to), byte(e.promo), byte(e.priority)
+    binary.LittleEndian.PutUint32(d[4:8], uint32(e.games))
+    binary.LittleEndian.PutUint32(d[8:12], uint32(e.won))
+    binary.LittleEndian.PutUint32(d[12:16], uint32(e.lost))
+    binary.LittleEndian.PutUint32(d[20:24], uint32(int32(e.child)))
+    binary.LittleEndian.PutUint32(d[24:28], uint32(int32(e.sibling)))
+  }
+
+  return data
+}
+
+// Plays the moves, in algebraic descriptive notation, from the starting
+// position.
+func boardAfter(t *testing.T, moves ...string) Chessboard {
+  board := boardFromFen(t, startFen)
+
+  for _, m := range moves {
+    if !board.MoveAlDescriptive(m) {
+      t.Fatalf("illegal move %s", m)
+    }
+  }
+
+  return board
+}
+
+// 1. Nf3 Nf6 2. d4 e6 and 1. d4 Nf6 2. Nf3 g6 (e6), which transpose.
+var abkTree = []abkTestEntry{
+  {900, "g1", "f3", 0, 50, 10, 4, 2, 902, 901},
+  {901, "d2", "d4", 0, 7, 0, 0, 0, 904, -1},
+  {902, "g8", "f6", 0, 0, 1, 1, 0, 903, -1},
+  {903, "d2", "d4", 0, 0, 0, 0, 0, 906, -1},
+  {904, "g8", "f6", 0, 0, 0, 0, 0, 905, -1},
+  {905, "g1", "f3", 0, 0, 0, 0, 0, 907, -1},
+  {906, "e7", "e6", 0, 3, 0, 0, 0, -1, -1},
+  {907, "g7", "g6", 0, 5, 0, 0, 0, -1, 908},
+  {908, "e7", "e6", 0, 9, 0, 0, 0, -1, -1},
+}
+
+func loadABKTree(t *testing.T) *ABKBook {
+  name := filepath.Join(t.TempDir(), "test.abk")
+
+  if err := ioutil.WriteFile(name, abkData(910, abkTree), 0644); err != nil {
+    t.Fatal(err)
+  }
+
+  book, err := LoadBook(name)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  return book.(*ABKBook)
+}
+
+func TestABKProbe(t *testing.T) {
+  book := loadABKTree(t)
+
+  cases := []struct {
+    moves []string
+    want []string
+    weights []int
+  }{
+    // Two points for a win and one for a draw, the priority for moves never
+    // played.
+    {nil, []string{"g1f3", "d2d4"}, []int{12, 7}},
+    {[]string{"g1f3"}, []string{"g8f6"}, []int{2}},
+
+    // Both lines reach the position, and the moves of the second one which
+    // were already found are left out.
+    {[]string{"g1f3", "g8f6", "d2d4"}, []string{"g7g6", "e7e6"}, []int{5, 3}},
+    {[]string{"d2d4", "g8f6", "g1f3"}, []string{"g7g6", "e7e6"}, []int{5, 3}},
+  }
+
+  for _, tc := range cases {
+    probed := book.Probe(boardAfter(t, tc.moves...))
+
+    if len(probed) != len(tc.want) {
+      t.Errorf("%v: probed %+v, want %v", tc.moves, probed, tc.want)
+      continue
+    }
+
+    for i, e := range probed {
+      if MoveToAl(e.Move) != tc.want[i] || e.Weight != tc.weights[i] || !e.Legal {
+        t.Errorf("%v: entry %d %+v, want %s weighted %d", tc.moves, i, e, tc.want[i], tc.weights[i])
+      }
+    }
+  }
+
+  first := book.Probe(boardAfter(t))[0]
+  if first.Priority != 50 || first.Games != 10 || first.Won != 4 || first.Lost != 2 {
+    t.Errorf("statistics %+v", first)
+  }
+}
+
+// ABK books number the promotion pieces rook, knight, bishop, queen, and
+// negate them for black.
+func TestABKPromotions(t *testing.T) {
+  cases := []struct {
+    fen string
+    from, to string
+    want []string
+  }{
+    {"8/4P3/8/8/8/8/k7/4K3 w - - 0 1", "e7", "e8", []string{"e7e8r", "e7e8n", "e7e8b", "e7e8q"}},
+    {"4k3/8/8/8/8/8/K3p3/8 b - - 0 1", "e2", "e1", []string{"e2e1r", "e2e1n", "e2e1b", "e2e1q"}},
+  }
+
+  for _, tc := range cases {
+    board := boardFromFen(t, tc.fen)
+
+    var entries []abkTestEntry
+    for i := range tc.want {
+      promo := int8(i + 1)
+      if board.turn {
+        promo = -promo
+      }
+
+      entries = append(entries, abkTestEntry{i, tc.from, tc.to, promo, 10 - i, 0, 0, 0, -1, i + 1})
+    }
+
+    book := &ABKBook{positions: make(map[uint64][]abkMove)}
+    book.walk(abkData(len(entries), entries), board, 0, make([]bool, len(entries)))
+
+    probed := book.Probe(board)
+
+    if len(probed) != len(tc.want) {
+      t.Fatalf("%s: probed %+v, want %v", tc.fen, probed, tc.want)
+    }
+
+    for i, e := range probed {
+      if MoveToAl(e.Move) != tc.want[i] {
+        t.Errorf("%s: entry %d is %s, want %s", tc.fen, i, MoveToAl(e.Move), tc.want[i])
+      }
+    }
+  }
+}
+
+// The moves convert to polyglot entries in polyglot order, without the moves
+// which have no weight.
+func TestABKEntries(t *testing.T) {
+  book := loadABKTree(t)
+
+  entry := func(moves []string, move string, weight uint16) Entry {
+    board := boardAfter(t, moves...)
+    m := []int{alToPos(move[:2]), alToPos(move[2:])}
+
+    return Entry{Key: board.BookHash(), Move: board.encodeBookMove(m[0], m[1], ""), Score: weight}
+  }
+
+  transposed := []string{"g1f3", "g8f6", "d2d4"}
+
+  want := []Entry{
+    entry(nil, "g1f3", 12),
+    entry(nil, "d2d4", 7),
+    entry([]string{"g1f3"}, "g8f6", 2),
+    entry(transposed, "g7g6", 5),
+    entry(transposed, "e7e6", 3),
+  }
+  sortBookEntries(want)
+
+  got := book.Entries()
+
+  if len(got) != len(want) {
+    t.Fatalf("entries %+v, want %+v", got, want)
+  }
+
+  for i := range want {
+    if got[i] != want[i] {
+      t.Errorf("entry %d: %+v, want %+v", i, got[i], want[i])
+    }
+  }
+}
@@ -2,10 +2,14 @@ package chessboard
 
 // Some code based on donna engine's handling of polyglot's files
 import (
-  "os"
   "encoding/binary"
-  "sort"
+  "errors"
+  "io/ioutil"
+  "math"
   "math/rand"
+  "sort"
+  "strings"
+  "sync"
   "time"
 )
 
@@ -220,90 +224,341 @@ type Entry struct {
 	Learn uint32
 }
 
+// A polyglot opening book. The whole file is read into memory once, and is
+// only modified afterwards by book learning, so a single book can be shared by
+// any number of boards.
 type OpeningBook struct {
-	name string
-	entries int64
+  name string
+  data []byte
+  entries int
+  learnFile string // Where learned values are saved, "" to not save them.
+  mu sync.RWMutex
 }
 
-func NewBook(name string) (*OpeningBook, error) {
-	book := &OpeningBook{name: name}
+// An opening book which can be probed for the moves of a position.
+type Book interface {
+  Name() string
+  Probe(c Chessboard) []BookEntry
+  Entries() []Entry // Every move of the book as a polyglot entry, in polyglot order.
+}
+
+// Books attached to newly created boards, in the order they are probed.
+var defaultBooks []Book
 
-	if fi, err := os.Stat(book.name); err != nil {
-		return nil, err
-	} else {
-		book.entries = fi.Size() / 16
-	}
+// How a move is chosen among the book moves for a position.
+type BookPolicy int
 
-	return book, nil
+const (
+  BookBest BookPolicy = iota // Always play the move with the highest weight.
+  BookWeighted // Play moves with a probability proportional to their weight.
+  BookTemperature // Like BookWeighted, with the weights raised to 1/temperature.
+)
+
+// The selection settings shared by every book. The random source is guarded
+// by its own lock, as boards may pick book moves concurrently.
+type bookSelection struct {
+  policy BookPolicy
+  temperature float64
+  maxPly int // Book moves are only played in the first maxPly plies, 0 for no limit.
+  mu sync.Mutex
+  rng *rand.Rand
 }
 
-// Based on lookup from donna go engine and polyglot C code.
-func (b *OpeningBook) lookup(hash uint64) (entries []Entry) {
-  var entry Entry
+var bookPolicy = &bookSelection{
+  policy: BookWeighted,
+  temperature: 1,
+  rng: rand.New(rand.NewSource(time.Now().UnixNano())),
+}
+
+// Sets how moves are chosen from the books. The temperature is only used by
+// BookTemperature: values below 1 favour the moves with the highest weights,
+// values above 1 flatten the distribution.
+func SetBookPolicy(policy BookPolicy, temperature float64) {
+  bookPolicy.mu.Lock()
+  defer bookPolicy.mu.Unlock()
+
+  if temperature <= 0 {
+    temperature = 1
+  }
+
+  bookPolicy.policy = policy
+  bookPolicy.temperature = temperature
+}
+
+// Sets the number of plies from the start of the game during which book
+// moves are played, 0 for no limit.
+func SetBookMaxPly(plies int) {
+  bookPolicy.mu.Lock()
+  defer bookPolicy.mu.Unlock()
+
+  bookPolicy.maxPly = plies
+}
+
+// Seeds the random source used to choose book moves, so that the moves
+// played can be reproduced.
+func SeedBook(seed int64) {
+  bookPolicy.mu.Lock()
+  defer bookPolicy.mu.Unlock()
+
+  bookPolicy.rng = rand.New(rand.NewSource(seed))
+}
+
+// Returns the number of plies during which book moves are played, 0 for no
+// limit.
+func (s *bookSelection) bookDepth() int {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+
+  return s.maxPly
+}
+
+// Returns the index of the move to play given the weights of the moves,
+// sorted in descending order and all > 0.
+func (s *bookSelection) choose(weights []int) int {
+  s.mu.Lock()
+  defer s.mu.Unlock()
+
+  if s.policy == BookBest || len(weights) == 1 {
+    return 0
+  }
+
+  p := make([]float64, len(weights))
+  total := 0.0
+
+  for i, w := range weights {
+    p[i] = float64(w)
+
+    if s.policy == BookTemperature {
+      p[i] = math.Pow(p[i] / float64(weights[0]), 1 / s.temperature)
+    }
+
+    total += p[i]
+  }
+
+  r := s.rng.Float64() * total
+
+  for i, w := range p {
+    if r < w {
+      return i
+    }
+
+    r -= w
+  }
 
-  file, err := os.Open(b.name)
+  return len(p) - 1
+}
+
+// Loads the polyglot book with the given file name into memory.
+func NewBook(name string) (*OpeningBook, error) {
+  data, err := ioutil.ReadFile(name)
 
   if err != nil {
-    return entries
+    return nil, err
+  }
+
+  if len(data) % 16 != 0 {
+    return nil, errors.New("The book " + name + " is not a polyglot book.")
+  }
+
+  return &OpeningBook{name: name, data: data, entries: len(data) / 16}, nil
+}
+
+// Loads a book, choosing the format from the file name: ABK for files ending
+// in .abk, polyglot otherwise.
+func LoadBook(name string) (Book, error) {
+  if strings.HasSuffix(strings.ToLower(name), ".abk") {
+    return NewABKBook(name)
+  }
+
+  return NewBook(name)
+}
+
+// Returns the file name the book was loaded from.
+func (b *OpeningBook) Name() string {
+  return b.name
+}
+
+// Sets the books which are attached to every board created afterwards by
+// NewChessboard. Books are probed in the order given, the first book with a
+// legal move for the position is used.
+func SetDefaultBooks(books ...Book) {
+  defaultBooks = books
+}
+
+// Sets the books probed by this board, in priority order.
+func (c *Chessboard) SetBooks(books ...Book) {
+  c.books = books
+}
+
+// Returns the book move for the position from the first book that has one,
+// or an empty slice. No moves are played past the maximum book depth.
+func (c Chessboard) bookMove() []int {
+  ply := 2 * (c.fullmoveNumber - 1)
+  if c.turn {
+    ply += 1
+  }
+
+  if limit := bookPolicy.bookDepth(); limit > 0 && ply >= limit {
+    return []int{}
+  }
+
+  for _, b := range c.books {
+    if m := pickBookMove(b, c); len(m) >= 2 {
+      return m
+    }
+  }
+
+  return []int{}
+}
+
+// An entry of a book for a position, as listed by Probe.
+type BookEntry struct {
+  Move []int // The from and to squares, and the promotion piece if any.
+  SAN string // The move in standard algebraic notation, "" if it is illegal.
+  Weight int // The polyglot weight of the move.
+  Learn int // The learn value of the move, in [-100, 100].
+  Legal bool
+  Priority, Games, Won, Lost int // Statistics of ABK books, 0 for polyglot books.
+}
+
+// Returns every entry of the book for the given position, including moves
+// which are illegal or which have no weight, sorted by descending weight.
+func (b *OpeningBook) Probe(c Chessboard) []BookEntry {
+  entries := b.lookup(c.BookHash())
+  sort.Stable(byBookScore{entries})
+
+  probed := make([]BookEntry, 0, len(entries))
+
+  for _, e := range entries {
+    move := b.move(c, e)
+    entry := BookEntry{Move: move, Weight: int(e.Score), Learn: e.learnValue()}
+
+    if entry.Legal = c.moveIsLegal(move[0], move[1], ""); entry.Legal {
+      entry.SAN = c.SAN(move[0], move[1], promoPieceString(move))
+    }
+
+    probed = append(probed, entry)
+  }
+
+  return probed
+}
+
+// Returns the number of entries in the book.
+func (b *OpeningBook) Len() int {
+  return b.entries
+}
+
+// Returns every entry of the book.
+func (b *OpeningBook) Entries() []Entry {
+  b.mu.RLock()
+  defer b.mu.RUnlock()
+
+  entries := make([]Entry, b.entries)
+  for i := range entries {
+    entries[i] = b.entry(i)
   }
-  defer file.Close()
-
-  first, current, last := int64(-1), int64(0), b.entries
-
-	for first < last {
-		current = (first + last) / 2
-		file.Seek(current * 16, 0)
-		binary.Read(file, binary.BigEndian, &entry)
-
-		if hash <= entry.Key {
-			last = current
-		} else {
-			first = current + 1
-		}
-	}
-
-  file.Seek(first * 16, 0)
-	for {
-		binary.Read(file, binary.BigEndian, &entry)
-		if hash != entry.Key {
-			break
-		} else {
-			entries = append(entries, entry)
-		}
-	}
 
   return entries
 }
 
-func (b *OpeningBook) move(entry Entry) ([]int) {
-	from, to := entry.from(), entry.to()
+// Decodes the entry at the given index of the book.
+func (b *OpeningBook) entry(i int) Entry {
+  d := b.data[i * 16 : (i + 1) * 16]
 
-	return []int{from, to}
+  return Entry{
+    Key: binary.BigEndian.Uint64(d[0:8]),
+    Move: binary.BigEndian.Uint16(d[8:10]),
+    Score: binary.BigEndian.Uint16(d[10:12]),
+    Learn: binary.BigEndian.Uint32(d[12:16]),
+  }
 }
 
-func (b *OpeningBook) pickMove(hash uint64) ([]int) {
-	// The generation of random numbers is too important to be left to chance.
-	// Returns pseudo-random integer in [0, limit] range. It panics if limit <= 0.
-	random := func(limit int) int {
-		rand.Seed(time.Now().Unix()); return rand.Intn(limit)
-	}
+// Returns all the entries for the given hash, using a binary search over the
+// (sorted) book.
+func (b *OpeningBook) lookup(hash uint64) (entries []Entry) {
+  b.mu.RLock()
+  defer b.mu.RUnlock()
+
+  first := b.search(hash)
 
-	entries := b.lookup(hash)
-	switch length := len(entries); length {
-	case 0:
-		return []int{}
-	case 1:
-		return b.move(entries[0])
-	default:
-		// Sort book entries by score and pick among two best moves.
-		sort.Sort(byBookScore{entries})
-		best := len(entries)
-    if 2 < best {
-      best = 2
+  for i := first; i < b.entries; i++ {
+    entry := b.entry(i)
+
+    if entry.Key != hash {
+      break
     }
 
-		return b.move(entries[random(best)])
-	}
+    entries = append(entries, entry)
+  }
+
+  return entries
+}
+
+// Returns the index of the first entry with a key >= hash.
+func (b *OpeningBook) search(hash uint64) int {
+  return sort.Search(b.entries, func(i int) bool {
+    return b.entry(i).Key >= hash
+  })
+}
+
+// Converts a book entry into a move on the given board. Returns the from and
+// to squares, followed by the promotion piece if there is one.
+func (b *OpeningBook) move(c Chessboard, entry Entry) ([]int) {
+  from, to := entry.from(), entry.to()
+
+  // Polyglot encodes castling as the king capturing its own rook.
+  if c.validPieceKing(from) && c.validPieceRook(to) &&
+     c.pieceColorOnPosition(from) == c.pieceColorOnPosition(to) {
+    if to > from {
+      to = from + 2
+    } else {
+      to = from - 2
+    }
+  }
+
+  if promo := entry.promotion(); promo != 0 {
+    return []int{from, to, promo}
+  }
+
+  return []int{from, to}
+}
+
+// Picks a legal move from the book for the given position using the book
+// policy, returns an empty slice if there is none.
+func pickBookMove(b Book, c Chessboard) ([]int) {
+  // Books may contain moves which are illegal in this position (bad entries
+  // or hash collisions), only consider the legal ones. Moves without any
+  // weight (including those unlearned through losses) are never played.
+  moves := make([][]int, 0, 8)
+  weights := make([]int, 0, 8)
+
+  for _, e := range b.Probe(c) {
+    if w := e.Weight * (100 + clamp(e.Learn, -maxLearn, maxLearn)) / 100; e.Legal && w > 0 {
+      moves = append(moves, e.Move)
+      weights = append(weights, w)
+    }
+  }
+
+  if len(moves) == 0 {
+    return []int{}
+  }
+
+  sort.Stable(byWeight{moves, weights})
+
+  return moves[bookPolicy.choose(weights)]
+}
+
+// Returns the learn value of the entry, a signed percentage in [-100, 100]
+// by which the weight of the move is adjusted. Books written by other
+// programs may hold any value, which is clamped.
+func (e *Entry) learnValue() int {
+  return clamp(int(int32(e.Learn)), -maxLearn, maxLearn)
+}
+
+// Returns the weight of the entry, adjusted by what has been learned about
+// the move. A move with a learn value of -100 has a weight of 0.
+func (e *Entry) weight() int {
+  return int(e.Score) * (100 + e.learnValue()) / 100
 }
 
 // Converts polyglot encoded "from" coordinate to our square.
@@ -318,42 +573,120 @@ func (e *Entry) to() int {
   return square
 }
 
+// Converts the polyglot promotion piece (1 knight to 4 queen) to our piece
+// value, 0 if the move is not a promotion.
+func (e *Entry) promotion() int {
+  promo := int((e.Move >> 12) & 7)
+
+  if promo == 0 {
+    return 0
+  }
+
+  return promo + 1
+}
+
+// Returns the polyglot hash of the position. It is kept up to date by the
+// moves made on the board, so it is cheap enough to be the key of the
+// transposition table.
 func (c Chessboard) BookHash() uint64 {
+  return c.key
+}
+
+// Computes the polyglot hash of the position from the whole board.
+func (c Chessboard) computeBookHash() uint64 {
   var key uint64 = 0
 
   for i, v := range(c.boardSquares) {
-    if v != -1 {
-      pieceVal := 2 * (int(v) % 10) - 1 - (int(v) / 10)
+    key ^= pieceKey(i, v)
+  }
 
-      r := 7 - rowFromPosition(i)
-      c := colFromPosition(i)
+  key ^= castleKey(c.ksCanCastle, c.qsCanCastle)
+  key ^= c.enPassantKey(c.enpassantPos)
 
-      key ^= randomPiece[64*int(pieceVal) + 8*r + c]
-    }
+  if !c.turn {
+    key ^= randomTurn[0]
+  }
+
+  return key
+}
+
+// Returns the part of the hash for the piece on a square, 0 for an empty
+// square.
+func pieceKey(pos int, piece int8) uint64 {
+  if piece == -1 {
+    return 0
   }
 
-  if c.ksCanCastle[0] {
+  pieceVal := 2 * (int(piece) % 10) - 1 - (int(piece) / 10)
+
+  r := 7 - rowFromPosition(pos)
+  c := colFromPosition(pos)
+
+  return randomPiece[64*int(pieceVal) + 8*r + c]
+}
+
+// Returns the part of the hash for the castling rights.
+func castleKey(ksCanCastle []bool, qsCanCastle []bool) uint64 {
+  var key uint64 = 0
+
+  if ksCanCastle[0] {
     key ^= randomCastle[0]
   }
 
-  if c.ksCanCastle[1] {
+  if ksCanCastle[1] {
     key ^= randomCastle[2]
   }
 
-  if c.qsCanCastle[0] {
+  if qsCanCastle[0] {
     key ^= randomCastle[1]
   }
 
-  if c.qsCanCastle[1] {
+  if qsCanCastle[1] {
     key ^= randomCastle[3]
   }
 
-  if !c.turn {
-    key ^= randomTurn[0]
+  return key
+}
+
+// Returns the part of the hash for the en passant square ep, with the side
+// to move and the pieces of the board. The en passant file is only hashed if
+// a pawn of the side to move is next to the pawn which has just moved, and
+// could capture it.
+func (c Chessboard) enPassantKey(ep int) uint64 {
+  if ep < 0 || ep > 63 {
+    return 0
   }
 
-  return key
+  color, pawnRow := 0, 3
+
+  if c.turn {
+    color, pawnRow = 1, 4
+  }
+
+  col := colFromPosition(ep)
+
+  for _, adj := range([]int{col - 1, col + 1}) {
+    pos := posFromRowColumn(pawnRow, adj)
+
+    if adj >= 0 && adj < 8 && c.validPiecePawn(pos) && c.validColorPiece(pos, color) {
+      return randomEnPassant[col]
+    }
+  }
+
+  return 0
+}
+
+type byWeight struct {
+  moves [][]int
+  weights []int
+}
+
+func (a byWeight) Len() int           { return len(a.weights) }
+func (a byWeight) Swap(i, j int)      {
+  a.moves[i], a.moves[j] = a.moves[j], a.moves[i]
+  a.weights[i], a.weights[j] = a.weights[j], a.weights[i]
 }
+func (a byWeight) Less(i, j int) bool { return a.weights[i] > a.weights[j] }
 
 type byBookScore struct {
 	list []Entry
@@ -361,4 +694,4 @@ type byBookScore struct {
 
 func (a byBookScore) Len() int           { return len(a.list) }
 func (a byBookScore) Swap(i, j int)      { a.list[i], a.list[j] = a.list[j], a.list[i] }
-func (a byBookScore) Less(i, j int) bool { return a.list[i].Score > a.list[j].Score }
+func (a byBookScore) Less(i, j int) bool { return a.list[i].weight() > a.list[j].weight() }
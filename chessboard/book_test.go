@@ -0,0 +1,154 @@
+package chessboard
+
+import (
+  "bytes"
+  "math/rand"
+  "testing"
+)
+
+// Makes an in-memory polyglot book of the entries, which must be sorted.
+func bookFromEntries(t *testing.T, entries []Entry) *OpeningBook {
+  var buf bytes.Buffer
+
+  if err := WriteBookEntries(&buf, entries); err != nil {
+    t.Fatal(err)
+  }
+
+  return &OpeningBook{name: "test", data: buf.Bytes(), entries: len(entries)}
+}
+
+// Returns the board of the position, with no books.
+func boardFromFen(t *testing.T, fen string) Chessboard {
+  board, err := NewChessboard(fen)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  board.SetBooks()
+
+  return board
+}
+
+// The keys of the positions listed in the Polyglot book format
+// specification, reached from the starting position by the given moves.
+var polyglotKeys = []struct {
+  moves []string
+  key uint64
+}{
+  {nil, 0x463b96181691fc9c},
+  {[]string{"e2e4"}, 0x823c9b50fd114196},
+  {[]string{"e2e4", "d7d5"}, 0x0756b94461c50fb0},
+  {[]string{"e2e4", "d7d5", "e4e5"}, 0x662fafb965db29d4},
+  {[]string{"e2e4", "d7d5", "e4e5", "f7f5"}, 0x22a48b5a8e47ff78},
+  {[]string{"e2e4", "d7d5", "e4e5", "f7f5", "e1e2"}, 0x652a607ca3f242c1},
+  {[]string{"e2e4", "d7d5", "e4e5", "f7f5", "e1e2", "e8f7"}, 0x00fdd303c946bdd9},
+  {[]string{"a2a4", "b7b5", "h2h4", "b5b4", "c2c4"}, 0x3c8123ea7b067637},
+  {[]string{"a2a4", "b7b5", "h2h4", "b5b4", "c2c4", "b4c3", "a1a3"}, 0x5c3f9b829b279560},
+}
+
+func TestBookHash(t *testing.T) {
+  for _, tc := range polyglotKeys {
+    board, err := NewChessboard(startFen)
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    for _, m := range tc.moves {
+      if !board.MoveAlDescriptive(m) {
+        t.Fatalf("%v: illegal move %s", tc.moves, m)
+      }
+    }
+
+    if key := board.BookHash(); key != tc.key {
+      t.Errorf("%v: key %016x, want %016x", tc.moves, key, tc.key)
+    }
+  }
+}
+
+// Encodes a move the way Polyglot books store it. Files and ranks count
+// from 0, promotions from 1 (knight) to 4 (queen).
+func polyglotMove(fromFile, fromRank, toFile, toRank, promo int) uint16 {
+  return uint16(promo << 12 | fromRank << 9 | fromFile << 6 | toRank << 3 | toFile)
+}
+
+func TestBookEntryMove(t *testing.T) {
+  cases := []struct {
+    fen string
+    move uint16
+    want string
+  }{
+    // Castling is encoded as the king capturing its own rook.
+    {"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", polyglotMove(4, 0, 7, 0, 0), "e1g1"},
+    {"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", polyglotMove(4, 0, 0, 0, 0), "e1c1"},
+    {"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", polyglotMove(4, 7, 7, 7, 0), "e8g8"},
+    {"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", polyglotMove(4, 7, 0, 7, 0), "e8c8"},
+
+    // A king next to its rook is not castling.
+    {"8/8/8/8/8/8/k7/4KR2 w - - 0 1", polyglotMove(4, 0, 4, 1, 0), "e1e2"},
+
+    {"8/4P3/8/8/8/8/k7/4K3 w - - 0 1", polyglotMove(4, 6, 4, 7, 0), "e7e8"},
+    {"8/4P3/8/8/8/8/k7/4K3 w - - 0 1", polyglotMove(4, 6, 4, 7, 1), "e7e8n"},
+    {"8/4P3/8/8/8/8/k7/4K3 w - - 0 1", polyglotMove(4, 6, 4, 7, 2), "e7e8b"},
+    {"8/4P3/8/8/8/8/k7/4K3 w - - 0 1", polyglotMove(4, 6, 4, 7, 3), "e7e8r"},
+    {"8/4P3/8/8/8/8/k7/4K3 w - - 0 1", polyglotMove(4, 6, 4, 7, 4), "e7e8q"},
+  }
+
+  for _, tc := range cases {
+    board, err := NewChessboard(tc.fen)
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    m := (&OpeningBook{}).move(board, Entry{Move: tc.move})
+
+    if al := MoveToAl(m); al != tc.want {
+      t.Errorf("%s: move %04x decoded as %s, want %s", tc.fen, tc.move, al, tc.want)
+    }
+  }
+}
+
+// The key kept up to date by the moves has to match the key computed from
+// the whole board, through castling, en passant, promotions, null moves and
+// moves taken back.
+func TestBookHashIncremental(t *testing.T) {
+  fens := []string{
+    startFen,
+    "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1",
+    "rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3",
+    "8/2P5/8/8/8/8/k4p2/4K3 w - - 0 1",
+  }
+
+  rng := rand.New(rand.NewSource(1))
+
+  for _, fen := range fens {
+    board, err := NewChessboard(fen)
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    var restores []RestoreData
+
+    for ply := 0; ply < 200; ply++ {
+      moves := board.AllLegalMoves()
+
+      if len(moves) == 0 || (len(restores) > 0 && rng.Intn(4) == 0) {
+        if len(restores) == 0 {
+          break
+        }
+
+        board.RestoreBoard(restores[len(restores) - 1])
+        restores = restores[:len(restores) - 1]
+      } else if rng.Intn(10) == 0 {
+        restores = append(restores, board.makeNullMove())
+      } else {
+        m := moves[rng.Intn(len(moves))]
+        _, restore := board.MakeMoveWithRestore(m[0], m[1], "")
+        restores = append(restores, restore)
+      }
+
+      if key, want := board.BookHash(), board.computeBookHash(); key != want {
+        t.Fatalf("%s: key %016x after %s, want %016x", fen, key, board.Fen(), want)
+      }
+    }
+  }
+}
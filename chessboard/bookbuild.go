@@ -0,0 +1,225 @@
+package chessboard
+
+// Builds polyglot opening books from collections of games. Moves are keyed
+// with the same hash as BookHash, so the resulting books can be read back by
+// OpeningBook.
+import (
+  "bufio"
+  "encoding/binary"
+  "io"
+  "sort"
+  "strconv"
+)
+
+// Options controlling which games and moves make it into a built book.
+type BookBuildOptions struct {
+  MinElo int // Both players must be rated at least MinElo, 0 to disable.
+  MaxPly int // Only the first MaxPly plies of each game are used.
+  MinCount int // Moves played fewer times than this are left out.
+  Results []string // The game results which are used, e.g. "1-0".
+  WinWeight int // Weight added for a move played by the winning side.
+  DrawWeight int // Weight added for a move played in a drawn game.
+  LossWeight int // Weight added for a move played by the losing side.
+}
+
+// Returns the options used by the bookbuild command by default: moves of the
+// winning side count twice as much as drawn ones, losing moves are ignored.
+func DefaultBookBuildOptions() BookBuildOptions {
+  return BookBuildOptions{
+    MaxPly: 24,
+    MinCount: 1,
+    Results: []string{"1-0", "0-1", "1/2-1/2"},
+    WinWeight: 2,
+    DrawWeight: 1,
+  }
+}
+
+type bookKey struct {
+  hash uint64
+  move uint16
+}
+
+type bookStat struct {
+  weight int
+  count int
+}
+
+// Accumulates weights per (position, move) over the games added to it.
+type BookBuilder struct {
+  options BookBuildOptions
+  stats map[bookKey]*bookStat
+  games int
+}
+
+// Creates an empty book builder.
+func NewBookBuilder(options BookBuildOptions) *BookBuilder {
+  return &BookBuilder{options: options, stats: make(map[bookKey]*bookStat)}
+}
+
+// Returns the number of games which have been added to the book.
+func (bb *BookBuilder) Games() int {
+  return bb.games
+}
+
+// Adds the main line of a game to the book. Returns false if the game was
+// filtered out by the options.
+func (bb *BookBuilder) AddGame(g *PGNGame) bool {
+  opts := bb.options
+
+  if indexOf(g.Result, opts.Results) == -1 {
+    return false
+  }
+
+  if opts.MinElo > 0 {
+    whiteElo, _ := strconv.Atoi(g.Tag("WhiteElo"))
+    blackElo, _ := strconv.Atoi(g.Tag("BlackElo"))
+
+    if whiteElo < opts.MinElo || blackElo < opts.MinElo {
+      return false
+    }
+  }
+
+  board, err := g.StartingBoard()
+  if err != nil {
+    return false
+  }
+
+  bb.games += 1
+
+  for i, m := range g.Moves {
+    if opts.MaxPly > 0 && i >= opts.MaxPly {
+      break
+    }
+
+    weight := opts.DrawWeight
+    if g.Result == "1-0" && !board.turn || g.Result == "0-1" && board.turn {
+      weight = opts.WinWeight
+    } else if g.Result == "1-0" || g.Result == "0-1" {
+      weight = opts.LossWeight
+    }
+
+    key := bookKey{board.BookHash(), board.encodeBookMove(m.From, m.To, m.Promotion)}
+
+    if !board.MakeMove(m.From, m.To, m.Promotion) {
+      break
+    }
+
+    stat, ok := bb.stats[key]
+    if !ok {
+      stat = &bookStat{}
+      bb.stats[key] = stat
+    }
+
+    stat.weight += weight
+    stat.count += 1
+  }
+
+  return true
+}
+
+// Returns the entries of the book, sorted by key and then by descending
+// weight. Weights are scaled per position to fit in 16 bits.
+func (bb *BookBuilder) Entries() []Entry {
+  weights := make(map[bookKey]int, len(bb.stats))
+
+  for k, v := range bb.stats {
+    if v.count >= bb.options.MinCount && v.weight > 0 {
+      weights[k] = v.weight
+    }
+  }
+
+  return entriesFromWeights(weights, nil)
+}
+
+// Converts accumulated weights into sorted book entries. Weights are scaled
+// down per position so that the largest one fits in 16 bits, and moves are
+// never scaled down to a weight of 0.
+func entriesFromWeights(weights map[bookKey]int, learn map[bookKey]uint32) []Entry {
+  entries := make([]Entry, 0, len(weights))
+  maxWeight := make(map[uint64]int)
+
+  for k, v := range weights {
+    if v > maxWeight[k.hash] {
+      maxWeight[k.hash] = v
+    }
+  }
+
+  for k, v := range weights {
+    if v <= 0 {
+      continue
+    }
+
+    if max := maxWeight[k.hash]; max > 0xFFFF {
+      v = v * 0xFFFF / max
+    }
+
+    if v == 0 {
+      v = 1
+    }
+
+    entries = append(entries, Entry{Key: k.hash, Move: k.move, Score: uint16(v), Learn: learn[k]})
+  }
+
+  sortBookEntries(entries)
+
+  return entries
+}
+
+// Writes the book in polyglot format.
+func (bb *BookBuilder) WriteBook(w io.Writer) error {
+  return WriteBookEntries(w, bb.Entries())
+}
+
+// Sorts entries in polyglot order: by key, then by descending weight.
+func sortBookEntries(entries []Entry) {
+  sort.Slice(entries, func(i, j int) bool {
+    if entries[i].Key != entries[j].Key {
+      return entries[i].Key < entries[j].Key
+    }
+
+    if entries[i].Score != entries[j].Score {
+      return entries[i].Score > entries[j].Score
+    }
+
+    return entries[i].Move < entries[j].Move
+  })
+}
+
+// Writes entries, which must already be sorted by key, as a polyglot book.
+func WriteBookEntries(w io.Writer, entries []Entry) error {
+  bw := bufio.NewWriter(w)
+
+  for _, e := range entries {
+    if err := binary.Write(bw, binary.BigEndian, e); err != nil {
+      return err
+    }
+  }
+
+  return bw.Flush()
+}
+
+// Encodes the move from -> to in the current position as a polyglot move,
+// the inverse of OpeningBook.move.
+func (c Chessboard) encodeBookMove(from int, to int, promopiece string) uint16 {
+  // Castling is encoded as the king capturing its own rook.
+  if c.validPieceKing(from) && c.castlingAttempt(c.pieceColorOnPosition(from), from, to) {
+    to = c.rookPositionBeforeCastle(c.pieceColorOnPosition(from), from, to)
+  }
+
+  move := uint16(colFromPosition(to)) |
+    uint16(7 - rowFromPosition(to)) << 3 |
+    uint16(colFromPosition(from)) << 6 |
+    uint16(7 - rowFromPosition(from)) << 9
+
+  if c.attemptedPromotion(from, to) {
+    promo := int(pieceVals["Q"])
+
+    if promopiece != "" {
+      promo = int(pieceVals[promopiece] % 10)
+    }
+
+    move |= uint16(promo - 1) << 12
+  }
+
+  return move
+}
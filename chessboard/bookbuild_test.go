@@ -0,0 +1,201 @@
+package chessboard
+
+import (
+  "os"
+  "path/filepath"
+  "strconv"
+  "testing"
+)
+
+// Returns a game from the starting position with the given result and
+// ratings, 0 for no rating.
+func buildGame(t *testing.T, result string, whiteElo int, blackElo int, moves ...string) *PGNGame {
+  g, err := NewPGNGameFromMoves(startFen, moves)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  g.Result = result
+  g.SetTag("Result", result)
+
+  if whiteElo > 0 {
+    g.SetTag("WhiteElo", strconv.Itoa(whiteElo))
+  }
+
+  if blackElo > 0 {
+    g.SetTag("BlackElo", strconv.Itoa(blackElo))
+  }
+
+  return g
+}
+
+func TestBookBuilderFilters(t *testing.T) {
+  options := DefaultBookBuildOptions()
+  options.MinElo = 2000
+  options.MaxPly = 2
+  options.Results = []string{"1-0", "0-1"}
+
+  cases := []struct {
+    name string
+    game *PGNGame
+    added bool
+  }{
+    {"result", buildGame(t, "1/2-1/2", 2100, 2100, "e2e4", "e7e5"), false},
+    {"unfinished", buildGame(t, "*", 2100, 2100, "e2e4", "e7e5"), false},
+    {"white elo", buildGame(t, "1-0", 1900, 2100, "e2e4", "e7e5"), false},
+    {"black elo", buildGame(t, "1-0", 2100, 1999, "e2e4", "e7e5"), false},
+    {"no elo", buildGame(t, "1-0", 0, 0, "e2e4", "e7e5"), false},
+    {"added", buildGame(t, "0-1", 2000, 2100, "e2e4", "e7e5", "g1f3", "b8c6"), true},
+  }
+
+  for _, tc := range cases {
+    bb := NewBookBuilder(options)
+
+    if added := bb.AddGame(tc.game); added != tc.added {
+      t.Errorf("%s: added %v, want %v", tc.name, added, tc.added)
+    }
+
+    games, entries := 0, 0
+    if tc.added {
+      // Only the first MaxPly plies, with a weight for the winning side.
+      games, entries = 1, 1
+    }
+
+    if bb.Games() != games || len(bb.Entries()) != entries {
+      t.Errorf("%s: %d games and entries %v, want %d and %d", tc.name, bb.Games(), bb.Entries(), games, entries)
+    }
+  }
+}
+
+// Three games of 1. e4 e5, 1. e4 c5 and 1. d4 d5.
+func weightedBook(t *testing.T, minCount int) *BookBuilder {
+  bb := NewBookBuilder(BookBuildOptions{
+    MinCount: minCount,
+    Results: []string{"1-0", "0-1", "1/2-1/2"},
+    WinWeight: 3,
+    DrawWeight: 2,
+    LossWeight: 1,
+  })
+
+  bb.AddGame(buildGame(t, "1-0", 0, 0, "e2e4", "e7e5"))
+  bb.AddGame(buildGame(t, "0-1", 0, 0, "e2e4", "c7c5"))
+  bb.AddGame(buildGame(t, "1/2-1/2", 0, 0, "d2d4", "d7d5"))
+
+  return bb
+}
+
+// Returns the entry of the book for the move, in algebraic descriptive
+// notation, played after the given moves.
+func builtEntry(t *testing.T, moves []string, move string, weight uint16) Entry {
+  board := boardAfter(t, moves...)
+  from, to := alToPos(move[:2]), alToPos(move[2:])
+
+  return Entry{Key: board.BookHash(), Move: board.encodeBookMove(from, to, ""), Score: weight}
+}
+
+func TestBookBuilderWeights(t *testing.T) {
+  want := []Entry{
+    builtEntry(t, nil, "e2e4", 3 + 1),
+    builtEntry(t, nil, "d2d4", 2),
+    builtEntry(t, []string{"e2e4"}, "e7e5", 1),
+    builtEntry(t, []string{"e2e4"}, "c7c5", 3),
+    builtEntry(t, []string{"d2d4"}, "d7d5", 2),
+  }
+  sortBookEntries(want)
+
+  checkEntries(t, "weights", weightedBook(t, 1).Entries(), want)
+
+  // Only 1. e4 was played twice.
+  checkEntries(t, "min count", weightedBook(t, 2).Entries(), []Entry{builtEntry(t, nil, "e2e4", 4)})
+}
+
+func checkEntries(t *testing.T, name string, got []Entry, want []Entry) {
+  if len(got) != len(want) {
+    t.Errorf("%s: entries %+v, want %+v", name, got, want)
+    return
+  }
+
+  for i := range want {
+    if got[i] != want[i] {
+      t.Errorf("%s: entry %d %+v, want %+v", name, i, got[i], want[i])
+    }
+  }
+}
+
+// Weights which do not fit in 16 bits are scaled down with the other
+// weights of their position, but never to 0.
+func TestEntriesFromWeights(t *testing.T) {
+  weights := map[bookKey]int{
+    {1, 1}: 200000,
+    {1, 2}: 100000,
+    {1, 3}: 1,
+    {2, 1}: 70000,
+    {3, 1}: 500,
+    {3, 2}: 0,
+  }
+
+  want := []Entry{
+    {Key: 1, Move: 1, Score: 65535},
+    {Key: 1, Move: 2, Score: 32767},
+    {Key: 1, Move: 3, Score: 1},
+    {Key: 2, Move: 1, Score: 65535},
+    {Key: 3, Move: 1, Score: 500},
+  }
+
+  checkEntries(t, "scaled", entriesFromWeights(weights, nil), want)
+}
+
+// A written book is sorted by key, and is read back by OpeningBook.
+func TestWriteBook(t *testing.T) {
+  name := filepath.Join(t.TempDir(), "built.bin")
+
+  f, err := os.Create(name)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  if err := weightedBook(t, 1).WriteBook(f); err != nil {
+    t.Fatal(err)
+  }
+
+  if err := f.Close(); err != nil {
+    t.Fatal(err)
+  }
+
+  book, err := NewBook(name)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  entries := book.Entries()
+
+  for i := 1; i < len(entries); i++ {
+    if entries[i].Key < entries[i - 1].Key {
+      t.Fatalf("entry %d is out of order: %+v", i, entries)
+    }
+  }
+
+  cases := []struct {
+    moves []string
+    want []string
+  }{
+    {nil, []string{"e2e4", "d2d4"}},
+    {[]string{"e2e4"}, []string{"c7c5", "e7e5"}},
+    {[]string{"d2d4"}, []string{"d7d5"}},
+  }
+
+  for _, tc := range cases {
+    probed := book.Probe(boardAfter(t, tc.moves...))
+
+    if len(probed) != len(tc.want) {
+      t.Errorf("%v: probed %+v, want %v", tc.moves, probed, tc.want)
+      continue
+    }
+
+    for i, e := range probed {
+      if MoveToAl(e.Move) != tc.want[i] || !e.Legal {
+        t.Errorf("%v: entry %d %+v, want %s", tc.moves, i, e, tc.want[i])
+      }
+    }
+  }
+}
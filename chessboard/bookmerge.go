@@ -0,0 +1,68 @@
+package chessboard
+
+// Merges several books, of any format, into one polyglot book.
+
+// How the weights of a move found in several books are combined.
+type BookMergePolicy int
+
+const (
+  // Weights of the same move are added together.
+  BookMergeSum BookMergePolicy = iota
+  // The largest weight of the move in any book is used.
+  BookMergeMax
+  // Each position is taken as a whole from the first book containing it.
+  BookMergePriority
+)
+
+// Merges the books into a single list of sorted entries, ready to be written
+// with WriteBookEntries. If normalize is set, the weights of each book are
+// first scaled per position to add up to 1000, so that books built with
+// different weighting schemes contribute equally. Learn values are kept from
+// the first book containing the move.
+func MergeBooks(books []Book, policy BookMergePolicy, normalize bool) []Entry {
+  weights := make(map[bookKey]int)
+  learn := make(map[bookKey]uint32)
+  owner := make(map[uint64]int) // The first book containing each position.
+
+  for n, b := range books {
+    entries := b.Entries()
+
+    for i := 0; i < len(entries); {
+      // Entries of the same position are consecutive.
+      j, total := i, 0
+      for ; j < len(entries) && entries[j].Key == entries[i].Key; j++ {
+        total += int(entries[j].Score)
+      }
+
+      for ; i < j; i++ {
+        e := entries[i]
+        k := bookKey{e.Key, e.Move}
+        w := int(e.Score)
+
+        if normalize && total > 0 {
+          w = w * 1000 / total
+        }
+
+        if first, ok := owner[e.Key]; !ok {
+          owner[e.Key] = n
+        } else if policy == BookMergePriority && first != n {
+          continue
+        }
+
+        if _, ok := learn[k]; !ok {
+          learn[k] = e.Learn
+        }
+
+        if policy == BookMergeMax {
+          if w > weights[k] {
+            weights[k] = w
+          }
+        } else {
+          weights[k] += w
+        }
+      }
+    }
+  }
+
+  return entriesFromWeights(weights, learn)
+}
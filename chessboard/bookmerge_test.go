@@ -0,0 +1,95 @@
+package chessboard
+
+import (
+  "testing"
+)
+
+func TestMergeBooks(t *testing.T) {
+  // Both books have position 1, with move 1 in common.
+  first := bookFromEntries(t, []Entry{
+    {Key: 1, Move: 1, Score: 300, Learn: 5},
+    {Key: 1, Move: 2, Score: 100},
+    {Key: 2, Move: 1, Score: 10},
+  })
+
+  second := bookFromEntries(t, []Entry{
+    {Key: 1, Move: 3, Score: 600},
+    {Key: 1, Move: 1, Score: 200, Learn: 7},
+    {Key: 3, Move: 1, Score: 40000},
+  })
+
+  // Position 3 again, its weights adding up to more than 16 bits hold.
+  third := bookFromEntries(t, []Entry{
+    {Key: 3, Move: 1, Score: 60000},
+    {Key: 3, Move: 2, Score: 30000},
+  })
+
+  cases := []struct {
+    name string
+    books []Book
+    policy BookMergePolicy
+    normalize bool
+    want []Entry
+  }{
+    {"sum", []Book{first, second}, BookMergeSum, false, []Entry{
+      {Key: 1, Move: 3, Score: 600},
+      {Key: 1, Move: 1, Score: 500, Learn: 5},
+      {Key: 1, Move: 2, Score: 100},
+      {Key: 2, Move: 1, Score: 10},
+      {Key: 3, Move: 1, Score: 40000},
+    }},
+    {"max", []Book{first, second}, BookMergeMax, false, []Entry{
+      {Key: 1, Move: 3, Score: 600},
+      {Key: 1, Move: 1, Score: 300, Learn: 5},
+      {Key: 1, Move: 2, Score: 100},
+      {Key: 2, Move: 1, Score: 10},
+      {Key: 3, Move: 1, Score: 40000},
+    }},
+    {"priority", []Book{first, second}, BookMergePriority, false, []Entry{
+      {Key: 1, Move: 1, Score: 300, Learn: 5},
+      {Key: 1, Move: 2, Score: 100},
+      {Key: 2, Move: 1, Score: 10},
+      {Key: 3, Move: 1, Score: 40000},
+    }},
+    {"priority reversed", []Book{second, first}, BookMergePriority, false, []Entry{
+      {Key: 1, Move: 3, Score: 600},
+      {Key: 1, Move: 1, Score: 200, Learn: 7},
+      {Key: 2, Move: 1, Score: 10},
+      {Key: 3, Move: 1, Score: 40000},
+    }},
+
+    // Every position of every book adds up to 1000.
+    {"sum normalized", []Book{first, second}, BookMergeSum, true, []Entry{
+      {Key: 1, Move: 1, Score: 750 + 250, Learn: 5},
+      {Key: 1, Move: 3, Score: 750},
+      {Key: 1, Move: 2, Score: 250},
+      {Key: 2, Move: 1, Score: 1000},
+      {Key: 3, Move: 1, Score: 1000},
+    }},
+    {"max normalized", []Book{first, second}, BookMergeMax, true, []Entry{
+      {Key: 1, Move: 1, Score: 750, Learn: 5},
+      {Key: 1, Move: 3, Score: 750},
+      {Key: 1, Move: 2, Score: 250},
+      {Key: 2, Move: 1, Score: 1000},
+      {Key: 3, Move: 1, Score: 1000},
+    }},
+
+    // The largest weight of a position is scaled down to 65535.
+    {"sum overflow", []Book{second, third}, BookMergeSum, false, []Entry{
+      {Key: 1, Move: 3, Score: 600},
+      {Key: 1, Move: 1, Score: 200, Learn: 7},
+      {Key: 3, Move: 1, Score: 65535},
+      {Key: 3, Move: 2, Score: 30000 * 65535 / 100000},
+    }},
+    {"sum overflow normalized", []Book{second, third}, BookMergeSum, true, []Entry{
+      {Key: 1, Move: 3, Score: 750},
+      {Key: 1, Move: 1, Score: 250, Learn: 7},
+      {Key: 3, Move: 1, Score: 1000 + 666},
+      {Key: 3, Move: 2, Score: 333},
+    }},
+  }
+
+  for _, tc := range cases {
+    checkEntries(t, tc.name, MergeBooks(tc.books, tc.policy, tc.normalize), tc.want)
+  }
+}
@@ -1,124 +1,805 @@
 package chessboard
 
 import (
+  "context"
   "fmt"
+  "sort"
+  "sync/atomic"
   "time"
 )
 
-// Runs the recursive Alpha-Beta function, returns the score, and a tuple
-// representing the move.
+// A score beyond any score a position can have, used as the initial bounds
+// of the search.
+const infinity = mateScore + 1
+
+// The state shared by the threads of a search.
+type searchShared struct {
+  stop int32 // Set to 1 (atomically) to stop every thread.
+  totalNodes int64 // The nodes of all the threads, counted atomically.
+  tt *transpositionTable
+  params SearchParams
+  start time.Time
+  limits SearchLimits
+  rootMoves []uint16 // The packed moves searched at the root, nil to search every move.
+  rootHash uint64
+  rootTurn bool // The side the engine plays, which draws are scored for.
+  report InfoHandler // nil when the progress is not reported.
+}
+
+// The state of one thread of a search, shared by the nodes it searches.
+// Thread 0 is the main thread, which reports the progress and decides when
+// the search ends.
+type searchState struct {
+  *searchShared
+  id int
+  nodes int
+  seldepth int // The deepest ply reached in the current iteration.
+  cutoffs int
+  firstMoveCutoffs int
+  history *moveHistory
+  rootDepth int // The depth of the current iteration.
+  noNullMove bool // Set while verifying a null move cutoff.
+  excluded []uint16 // Root moves starting the lines of MultiPV already found.
+
+  completedDepth int // The depth of the last completed iteration.
+  lines []pvLine // The lines found by the last completed iteration, best first.
+
+  // The triangular principal variation table: the line found from the node
+  // at ply i is pvTable[i][i:pvLength[i]], as packed moves.
+  pvTable [maxPly + 1][maxPly + 1]uint16
+  pvLength [maxPly + 1]int
+
+  keys [maxPly + 1]uint64 // The keys of the positions from the root to the current node.
+}
+
+// Returns true once the search has to stop.
+func (s *searchShared) stopped() bool {
+  return atomic.LoadInt32(&s.stop) == 1
+}
+
+// Stops every thread of the search.
+func (s *searchShared) setStop() {
+  atomic.StoreInt32(&s.stop, 1)
+}
+
+// Makes m followed by the line of its child at ply + 1 the line of the node
+// at ply.
+func (s *searchState) updatePV(ply int, m []int) {
+  s.pvTable[ply][ply] = packMove(m)
+  length := s.pvLength[ply + 1]
+
+  copy(s.pvTable[ply][ply + 1:length], s.pvTable[ply + 1][ply + 1:length])
+  s.pvLength[ply] = length
+}
+
+// Returns the line found from the root.
+func (s *searchState) rootPV() [][]int {
+  pv := make([][]int, s.pvLength[0])
+
+  for i := range pv {
+    pv[i] = unpackMove(s.pvTable[0][i])
+  }
+
+  return pv
+}
+
+// Returns true if the move is searched at the root.
+func (s *searchState) isRootMove(m []int) bool {
+  return (s.rootMoves == nil || containsMove(s.rootMoves, m)) && !containsMove(s.excluded, m)
+}
+
+// Counts a node, and stops the search once its node limit is reached or its
+// time is up. Only the main thread looks at the clock, and only every 1024
+// nodes, as reading it is slow.
+func (s *searchState) countNode() {
+  s.nodes += 1
+  total := atomic.AddInt64(&s.totalNodes, 1)
+
+  if s.limits.Nodes > 0 && total >= int64(s.limits.Nodes) {
+    s.setStop()
+  }
+
+  if tm := s.limits.Time; s.id == 0 && tm != nil && s.nodes & 1023 == 0 && tm.hardLimitReached() {
+    s.setStop()
+  }
+}
+
+// Returns the score of a position where the side to move has no legal moves.
+// Being checkmated scores -mateScore plus the distance to the root, so that
+// the shortest mate and the longest defence are preferred.
+func (c *Chessboard) noMovesScore(inCheck bool, ply int) int {
+  // Checkmate
+  if inCheck {
+    return -mateScore + ply
+  }
+
+  // Stalemate
+  return 0
+}
+
+// Returns true if the position at ply is a draw by the fifty-move rule, or
+// repeats a position of the line searched to reach it. The positions played
+// before the root are not known to the board, and only a repetition within
+// the search is found. A single repetition is scored as a draw, as the
+// side which could avoid it would have done so the first time.
+func (s *searchState) isDraw(c *Chessboard, ply int, prevMoves [][]int) bool {
+  if c.halfmoveClock >= 100 {
+    return true
+  }
+
+  // Positions before the last capture or pawn move cannot come back, and
+  // neither can those before a null move, which is not a real move.
+  first := ply - c.halfmoveClock
+  if first < 0 {
+    first = 0
+  }
+
+  for i := len(prevMoves) - 1; i >= first; i-- {
+    if prevMoves[i] == nil {
+      first = i + 1
+      break
+    }
+  }
+
+  for i := ply - 4; i >= first; i -= 2 {
+    if s.keys[i] == s.keys[ply] {
+      return true
+    }
+  }
+
+  return false
+}
+
+// Returns the score of a draw for the side to move at a node. With
+// contempt, a draw is worth less than 0 to the side the engine plays, which
+// then avoids it, and as much more to its opponent. The score varies by a
+// centipawn from node to node, so that the search does not take every
+// draw as equal and keep choosing the first repetition it finds.
+func (s *searchState) drawScore(c *Chessboard) int {
+  score := -s.params.Contempt
+  if c.turn != s.rootTurn {
+    score = -score
+  }
+
+  return score - 1 + (s.nodes & 2)
+}
+
+// Runs the recursive Alpha-Beta function, and returns the score. The line
+// found from the node is left in the principal variation table of s, and is
+// only complete for scores inside of the window.
+//
+// The search is selective: besides the moves cut off by alpha-beta, moves
+// and whole positions which are unlikely to matter are pruned or searched
+// at a reduced depth, and forcing lines are extended (see selectivity.go).
+// A nil move in prevMoves is a null move.
 
 // BUG: Very slow for depth >= 6, this shouldn't be happening, some
 // optimizations probably can be added.
-func (c *Chessboard) alphaBetaHelper(a int, b int, depth int, prevMoves [][]int, searchStop *bool) (int, [][]int, int) {
-  if depth == 0 || *searchStop {
-    if *searchStop {
-      fmt.Println("Search Stop")
+func (c *Chessboard) alphaBetaHelper(a int, b int, depth int, ply int, prevMoves [][]int, s *searchState) int {
+  s.pvLength[ply] = ply
+
+  if s.stopped() {
+    return c.Evaluate()
+  }
+
+  if ply >= maxPly {
+    return c.Evaluate()
+  }
+
+  hash := c.BookHash()
+  s.keys[ply] = hash
+
+  if ply > 0 && s.isDraw(c, ply, prevMoves) {
+    return s.drawScore(c)
+  }
+
+  // Mate distance pruning: no line from here can be better than mating
+  // at the next ply, or worse than being mated now, so when a shorter mate
+  // has already been found the node cannot change the result. The window
+  // itself is left alone, as a fail-hard search must not return scores
+  // outside of the window it was given.
+  if ply > 0 {
+    mateAlpha, mateBeta := a, b
+
+    if mateAlpha < -mateScore + ply {
+      mateAlpha = -mateScore + ply
     }
 
-    // TODO: Quiesce instead of straight-up evaluation.
-    return c.Evaluate(), prevMoves, 1
+    if mateBeta > mateScore - ply - 1 {
+      mateBeta = mateScore - ply - 1
+    }
+
+    // Even then, the score returned is kept inside of the window.
+    if mateAlpha >= mateBeta {
+      if mateAlpha > b {
+        return b
+      }
+
+      return mateAlpha
+    }
   }
 
-  var moves [][]int = c.AllLegalMoves()
-  alpha := a
-  beta := b
+  p := &s.params
 
   color := 0
   if c.turn {
     color = 1
   }
 
-  // Checkmate
-  if c.kingInCheck(color) && len(moves) == 0 {
-    return 9999, prevMoves, 1
+  // Extensions are limited to twice the depth of the iteration, so that
+  // long sequences of checks do not blow up the search.
+  extend := ply < 2 * s.rootDepth
+  inCheck := c.kingInCheck(color)
+
+  if inCheck && p.CheckExtension && extend {
+    depth += 1
   }
 
-  // Stalemate
-  if !(c.kingInCheck(color)) && len(moves) == 0 {
-    return 0, prevMoves, 1
+  if depth <= 0 {
+    return c.quiesce(a, b, ply, 0, s)
   }
 
-  var combined [][]int
-  nodesSearched := 0
+  s.countNode()
+
+  if ply > s.seldepth {
+    s.seldepth = ply
+  }
+
+  alpha := a
+  beta := b
+
+  // A deep enough result from the table can be used instead of searching,
+  // except at the root where a move has to be found.
+  var hashMove []int
+
+  if e, ok := s.tt.probe(hash); ok {
+    hashMove = e.move()
+    score := scoreFromTT(e.score(), ply)
+
+    if ply > 0 && e.depth() >= depth {
+      switch {
+      case e.bound() == boundExact:
+        return score
+      case e.bound() == boundLower && score >= beta:
+        return beta
+      case e.bound() == boundUpper && score <= alpha:
+        return alpha
+      }
+    }
+  }
+
+  var prev []int
+  if len(prevMoves) > 0 {
+    prev = prevMoves[len(prevMoves) - 1]
+  }
+
+  // Principal variation search: the first move is expected to be the best
+  // one, so the other moves are only searched with a null window to prove
+  // that they are not better, and searched again with the full window when
+  // one turns out to be.
+  pvNode := beta - alpha > 1
+
+  // Nodes on the principal variation are searched in full, the others are
+  // pruned based on the static evaluation.
+  futile := false
+
+  if !pvNode && !inCheck && ply > 0 && s.limits.Mate == 0 {
+    eval := c.Evaluate()
+
+    if p.ReverseFutility && depth <= p.ReverseFutilityDepth && eval - p.ReverseFutilityMargin * depth >= beta {
+      return beta
+    }
+
+    if p.Razoring && depth <= p.RazorDepth && eval + p.RazorMargin * depth <= alpha {
+      if c.quiesce(alpha, beta, ply, 0, s) <= alpha {
+        return alpha
+      }
+    }
+
+    // Null moves are not made twice in a row, and not when the side to move
+    // only has pawns left, as it is then likely to be in zugzwang.
+    if p.NullMove && !s.noNullMove && depth >= 2 && eval >= beta && prev != nil && c.nonPawnMaterial(color) > 0 {
+      if score, ok := c.nullMoveCutoff(beta, depth, ply, prevMoves, s); ok {
+        return score
+      }
+
+      if s.stopped() {
+        return alpha
+      }
+    }
+
+    futile = p.Futility && depth <= p.FutilityDepth && eval + p.FutilityMargin * depth <= alpha
+  }
+
+  // The score of a root searching only some of the moves is not the score
+  // of the position, and is not stored.
+  restricted := ply == 0 && (s.rootMoves != nil || s.excluded != nil)
+
+  var bestMove []int
+  quiets := make([][]int, 0, 32)
+  legalMoves := 0
+  searched := 0
+  picker := s.newMovePicker(c, hashMove, ply, prev)
+
+  for m := picker.next(); m != nil; m = picker.next() {
+    if ply == 0 && !s.isRootMove(m) {
+      continue
+    }
+
+    quiet := !c.isTactical(m)
+    newDepth := depth - 1
+
+    if p.PassedPawnExtension && extend && c.passedPawnPush(m) {
+      newDepth += 1
+    }
+
+    // The picker's moves are only pseudo-legal, illegal ones are rejected
+    // (and undone) by the move itself.
+    legal, restore := c.MakeMoveWithRestore(m[0], m[1], "")
+    if !legal {
+      continue
+    }
+
+    legalMoves += 1
+
+    // Quiet moves which do not give check may be pruned or reduced once a
+    // move has been searched. A mate search has to see every move.
+    selective := s.limits.Mate == 0 && !inCheck
+    lmp := p.LateMovePruning && selective && !pvNode && depth <= p.LMPDepth &&
+           len(quiets) >= p.LMPMoveCount + depth * depth
+    lmr := p.LateMoveReductions && selective && depth >= p.LMRMinDepth && searched >= p.LMRMoveCount
+    reducible := quiet && searched > 0 && (futile || lmp || lmr) && !c.kingInCheck(1 - color)
+
+    if reducible && (futile || lmp) {
+      c.RestoreBoard(restore)
+      continue
+    }
+
+    searched += 1
+    if quiet {
+      quiets = append(quiets, m)
+    }
 
-  for _, m := range(moves) {
-    _, restore := c.MakeMoveWithRestore(m[0], m[1], "")
     mHist := append(prevMoves, m)
 
-    score, forwardMoves, nSearch := c.alphaBetaHelper(-beta, -alpha, depth - 1, mHist, searchStop)
-    nodesSearched += nSearch
+    var score int
+
+    if searched == 1 {
+      score = c.alphaBetaHelper(-beta, -alpha, newDepth, ply + 1, mHist, s)
+      score = -score
+    } else {
+      // A reduced search of a late move is only trusted when it fails low.
+      reduction := 0
+
+      if reducible {
+        reduction = lmrReduction(depth, searched)
+
+        if pvNode {
+          reduction -= 1
+        }
+
+        if reduction > newDepth - 1 {
+          reduction = newDepth - 1
+        }
+      }
+
+      score = alpha + 1
+
+      if reduction > 0 {
+        score = c.alphaBetaHelper(-alpha - 1, -alpha, newDepth - reduction, ply + 1, mHist, s)
+        score = -score
+      }
+
+      if score > alpha && !s.stopped() {
+        score = c.alphaBetaHelper(-alpha - 1, -alpha, newDepth, ply + 1, mHist, s)
+        score = -score
+      }
+
+      if pvNode && score > alpha && score < beta && !s.stopped() {
+        score = c.alphaBetaHelper(-beta, -alpha, newDepth, ply + 1, mHist, s)
+        score = -score
+      }
+    }
 
-    score = -score
     c.RestoreBoard(restore)
 
+    if s.stopped() {
+      return alpha
+    }
+
     if score >= beta {
-      return beta, make([][]int, 0), nodesSearched
+      s.cutoffs += 1
+      if searched == 1 {
+        s.firstMoveCutoffs += 1
+      }
+
+      if quiet {
+        s.updateQuietHistory(c, m, quiets, depth, ply, prev)
+      }
+
+      if !restricted {
+        s.tt.store(hash, m, scoreToTT(beta, ply), depth, boundLower)
+      }
+
+      return beta
     }
 
     if (score > alpha) {
       alpha = score
-      combined = make([][]int, len(forwardMoves))
-      copy(combined, forwardMoves)
+      bestMove = m
+      s.updatePV(ply, m)
     }
   }
 
-  return alpha, combined, nodesSearched
+  if legalMoves == 0 {
+    if !inCheck {
+      return s.drawScore(c)
+    }
+
+    return c.noMovesScore(inCheck, ply)
+  }
+
+  if restricted {
+    return alpha
+  }
+
+  if bestMove != nil {
+    s.tt.store(hash, bestMove, scoreToTT(alpha, ply), depth, boundExact)
+  } else {
+    s.tt.store(hash, nil, scoreToTT(alpha, ply), depth, boundUpper)
+  }
+
+  return alpha
 }
 
-// Calls the Alpha-Beta helper with a seed alpha and beta value, along with
-// the given depth.
-func (c Chessboard) AlphaBeta(depth int, searchStop *bool) (int, []int) {
-  var cm []int
+// Tries a null move at a node where the static evaluation is at least beta:
+// if the side to move passes and a reduced search still fails high, the
+// node fails high too. Returns the score and whether the node can be cut
+// off.
+//
+// In endings, where zugzwang makes passing the best move more often, the
+// cutoff is verified by a reduced search of the node without null moves.
+func (c *Chessboard) nullMoveCutoff(beta int, depth int, ply int, prevMoves [][]int, s *searchState) (int, bool) {
+  p := &s.params
+  reduced := depth - 1 - p.NullMoveReduction
+  if reduced < 0 {
+    reduced = 0
+  }
+
+  color := 0
+  if c.turn {
+    color = 1
+  }
+
+  restore := c.makeNullMove()
+  score := c.alphaBetaHelper(-beta, -beta + 1, reduced, ply + 1, append(prevMoves, nil), s)
+  score = -score
+  c.RestoreBoard(restore)
 
-  if c.book.name != "" {
-    cm = c.book.pickMove(c.BookHash())
+  if s.stopped() || score < beta {
+    return 0, false
   }
 
-  var score int
-  var m []int
-  var moves [][]int
-  var nSearch int
-  totalNodes := 0
+  if p.NullMoveVerification && reduced > 0 && c.nonPawnMaterial(color) <= pieceValues[4] {
+    s.noNullMove = true
+    score = c.alphaBetaHelper(beta - 1, beta, reduced, ply, prevMoves, s)
+    s.noNullMove = false
 
-  start := time.Now()
+    if s.stopped() || score < beta {
+      return 0, false
+    }
+  }
+
+  return beta, true
+}
+
+var lastPV [][]int
+
+// Returns the principal variation of the last search run by AlphaBeta,
+// starting with the move it returned. The second move is the reply expected
+// from the opponent, which can be pondered on.
+func LastPV() [][]int {
+  return lastPV
+}
 
+// The limits of a search. The search ends at the first limit reached, or
+// when its context is done.
+type SearchLimits struct {
+  Depth int // The deepest iteration, 0 for no limit.
+  Nodes int // Stop after this many nodes, 0 for no limit.
+  Mate int // Search for a mate in this many moves, stopping once one is found. 0 for a normal search.
+  Time *TimeManager // nil when the search is not timed.
+  SearchMoves []string // Only search these root moves (e.g. e2e4), all moves if empty.
+  MultiPV int // The number of best lines searched and reported, 1 if 0.
+}
+
+// Searches the position with a single thread until one of the limits is
+// reached, printing the progress as UCI info lines. Returns the score from
+// white's point of view, and the move found, nil when the position is mate
+// or stalemate. The principal variation and the statistics of the search
+// are kept for LastPV and LastSearchStats.
+//
+// See Searcher.Search for how the search works.
+func (c Chessboard) AlphaBeta(limits SearchLimits) (int, []int) {
+  searcher := &Searcher{Threads: 1, Info: PrintInfo}
+  result := searcher.Search(context.Background(), c, limits)
+
+  if result.Book {
+    fmt.Println("info string book move " + MoveToAl(result.Move))
+  }
+
+  lastPV = result.PV
+  lastSearchStats = result.Stats
+
+  if c.turn {
+    return -result.Score, result.Move
+  }
+
+
+  return result.Score, result.Move
+}
+
+// Runs the iterations of a thread of the search, from depth 1 to depth,
+// until the search is stopped. The lines of the last completed iteration
+// are kept in s.lines.
+//
+// Only the main thread reports the progress and checks the time and mate
+// limits. Helper threads skip some depths, so that the threads do not all
+// search the same depth at the same time (see smp.go).
+func (c *Chessboard) iterativeDeepening(depth int, multiPV int, s *searchState) {
   for i := 1; i <= depth; i++ {
-    score, moves, nSearch = c.alphaBetaHelper(-10000, 10000, i, make([][]int, 0, i), searchStop)
+    if s.id != 0 && skipDepth(s.id, i) {
+      continue
+    }
+
+    s.seldepth = 0
+    s.rootDepth = i
+
+    // Every line after the first is the best line among the root moves
+    // which do not start one of the lines before it.
+    iterLines := make([]pvLine, 0, multiPV)
+    s.excluded = nil
 
-    if *searchStop {
+    for k := 0; k < multiPV; k++ {
+      prevScore, aspiration := 0, false
+      if k < len(s.lines) {
+        prevScore, aspiration = s.lines[k].score, true
+      }
+
+      line := c.aspirationSearch(i, k + 1, prevScore, aspiration, s)
+
+      if s.stopped() {
+        break
+      }
+
+      iterLines = append(iterLines, line)
+      s.excluded = append(s.excluded, packMove(line.moves[0]))
+    }
+
+    s.excluded = nil
+
+    if s.stopped() {
         break
     }
 
-    m = moves[0]
+    // The lines are searched best first, but a later search can find a
+    // better score than an earlier one, e.g. with more information in the
+    // transposition table.
+    sort.SliceStable(iterLines, func(a, b int) bool {
+      return iterLines[a].score > iterLines[b].score
+    })
 
-    pv := ""
+    s.lines = iterLines
+    s.completedDepth = i
 
-    for j := 0; j < len(moves); j++ {
-      pv += PosToAl(moves[j][0]) + PosToAl(moves[j][1]) + " "
+    if s.id != 0 {
+      continue
     }
 
-    pv = pv[0:(len(pv) - 1)]
+    for k, line := range s.lines {
+      s.info(i, k + 1, line.score, "", line.moves)
+    }
+
+    score := s.lines[0].score
 
-    t := time.Now()
-    elapsed := t.Sub(start)
-    nps := int(float64(nSearch) / elapsed.Seconds())
-    elap := int(elapsed.Seconds() * 1000.0)
-    totalNodes += nSearch
+    if tm := s.limits.Time; tm != nil && !tm.iterationDone(score, s.lines[0].moves[0]) {
+      break
+    }
 
-    fmt.Printf("info depth %d nodes %d nps %d score cp %d time %d multipv 1 pv %s\n", i, nSearch, nps, score, elap, pv)
+    if n, ok := MateIn(score); s.limits.Mate > 0 && ok && n > 0 && n <= s.limits.Mate {
+      break
+    }
   }
+}
+
+// A line found by the search at the root: its score and its moves.
+type pvLine struct {
+  score int
+  moves [][]int
+}
 
-  if len(cm) == 2 {
-    m = cm
+// Searches the root to the given depth, with an aspiration window around
+// prevScore when aspiration is set, and a full window otherwise. When the
+// score falls outside of the window, the bound is reported to the GUI and
+// the window is widened on that side until the score falls inside.
+func (c *Chessboard) aspirationSearch(depth int, multipv int, prevScore int, aspiration bool, s *searchState) pvLine {
+  alpha, beta := -infinity, infinity
+  delta := s.params.AspirationWindow
+
+  if aspiration && delta > 0 {
+    alpha, beta = prevScore - delta, prevScore + delta
   }
 
-  if c.turn {
-    return -score, m
+  for {
+    score := c.alphaBetaHelper(alpha, beta, depth, 0, make([][]int, 0, depth), s)
+
+    if s.stopped() {
+      return pvLine{}
+    }
+
+    if score <= alpha && alpha > -infinity {
+      if s.id == 0 {
+        s.info(depth, multipv, score, "upperbound", nil)
+      }
+
+      alpha -= delta
+    } else if score >= beta && beta < infinity {
+      if s.id == 0 {
+        s.info(depth, multipv, score, "lowerbound", nil)
+      }
+
+      beta += delta
+    } else {
+      return pvLine{score: score, moves: c.completePV(s.rootPV(), s)}
+    }
+
+    delta *= 2
+    if alpha < -mateScore {
+      alpha = -infinity
+    }
+
+    if beta > mateScore {
+      beta = infinity
+    }
+  }
+}
+
+// Returns the legal start of the line pv, extended with the moves of the
+// transposition table. The line of the table is cut short where it stops,
+// e.g. at a cutoff from the table, and the table may know how it goes on.
+// The extension ends at a move which is not legal or repeats a position of
+// the line.
+func (c Chessboard) completePV(pv [][]int, s *searchState) [][]int {
+  b := c.Copy()
+  line := make([][]int, 0, len(pv))
+  seen := map[uint64]bool{b.BookHash(): true}
+
+  for len(line) < maxPly {
+    var m []int
+
+    if len(line) < len(pv) {
+      m = pv[len(line)]
+    } else if e, ok := s.tt.probe(b.BookHash()); ok {
+      m = e.move()
+    }
+
+    if m == nil || !b.pseudoLegal(m) {
+      break
+    }
+
+    m = b.withPromotion(m)
+
+    if legal, _ := b.MakeMoveWithRestore(m[0], m[1], ""); !legal {
+      break
+    }
+
+    hash := b.BookHash()
+    if seen[hash] {
+      break
+    }
+
+    seen[hash] = true
+    line = append(line, m)
+  }
+
+  return line
+}
+
+// Returns the move with the queen as its promotion piece when it is a pawn
+// move to the last rank. The search only promotes to queens and leaves the
+// piece out, but the moves it returns have to name it.
+func (c Chessboard) withPromotion(m []int) []int {
+  if len(m) == 2 && c.attemptedPromotion(m[0], m[1]) {
+    return []int{m[0], m[1], 5}
   }
 
+  return m
+}
+
+// Returns the packed legal moves among the given moves in algebraic
+// descriptive notation, nil if there are none, in which case every move is
+// searched. Promotions are always to a queen in the search, so the
+// promotion piece is ignored.
+func (c Chessboard) legalRootMoves(moves []string) []uint16 {
+  var legal, rootMoves []uint16
+
+  for _, m := range c.AllLegalMoves() {
+    legal = append(legal, packMove(m))
+  }
+
+  for _, al := range moves {
+    if len(al) < 4 {
+      continue
+    }
+
+    m := []int{alToPos(al[0:2]), alToPos(al[2:4])}
+
+    if m[0] >= 0 && m[0] < 64 && m[1] >= 0 && m[1] < 64 && containsMove(legal, m) && !containsMove(rootMoves, m) {
+      rootMoves = append(rootMoves, packMove(m))
+    }
+  }
+
+  return rootMoves
+}
+
+// Returns true if moves holds a move with the same from and to squares as
+// m, ignoring the promotion piece.
+func containsMove(moves []uint16, m []int) bool {
+  packed := packMove(m[:2])
+
+  for _, r := range moves {
+    if r & 0xFFF == packed {
+      return true
+    }
+  }
+
+  return false
+}
+
+// Reports the progress of the search to the info handler, for the line
+// multipv. bound is "lowerbound" or "upperbound" when the score is only a
+// bound, and empty when it is exact, in which case pv is the line.
+func (s *searchState) info(depth int, multipv int, score int, bound string, pv [][]int) {
+  if s.report == nil {
+    return
+  }
+
+  elapsed := time.Since(s.start)
+  nodes := int(atomic.LoadInt64(&s.totalNodes))
+
+  s.report(Info{
+    Depth: depth,
+    SelDepth: s.seldepth,
+    Nodes: nodes,
+    NPS: int(float64(nodes) / elapsed.Seconds()),
+    Score: score,
+    Bound: bound,
+    Time: elapsed,
+    HashFull: s.tt.hashFull(),
+    MultiPV: multipv,
+    PV: pv,
+  })
+}
+
+// Returns the number of moves until mate for a mate score, negative when
+// the side the score is for gets mated, and false for other scores.
+func MateIn(score int) (int, bool) {
+  if score >= mateInMaxPly {
+    return (mateScore - score + 1) / 2, true
+  } else if score <= -mateInMaxPly {
+    return -(mateScore + score) / 2, true
+  }
+
+  return 0, false
+}
+
+// Formats a score for UCI, "mate N" for mate scores and "cp N" otherwise.
+func uciScore(score int) string {
+  if n, ok := MateIn(score); ok {
+    return fmt.Sprintf("mate %d", n)
+  }
 
-  return score, m
+  return fmt.Sprintf("cp %d", score)
 }
 
 // Uses the negamax algorithm to find a move.
@@ -33,8 +33,11 @@ type Chessboard struct {
   enpassantPos int // The position for an enpassant capture, -1 if it doesnt exist.
   ksCanCastle []bool // Can players castle king-side? (0 white, 1 black)
   qsCanCastle []bool // Can players castle queen-side? (0 white, 1 black)
-  book OpeningBook
+  books []Book // Opening books probed in priority order.
   turn bool // false for white's move, true for black's move
+  halfmoveClock int // Plies since the last capture or pawn move.
+  fullmoveNumber int // Starts at 1, incremented after black's move.
+  key uint64 // The polyglot hash of the position, updated by every move.
 }
 
 // Struct to represent changes to the board.
@@ -43,6 +46,9 @@ type RestoreData struct {
   enpassantPos int
   ksCanCastle []bool
   qsCanCastle []bool
+  halfmoveClock int
+  fullmoveNumber int
+  key uint64
 }
 
 // Creates a new chessboard from a given fen position. Either returns the
@@ -56,13 +62,7 @@ func NewChessboard(fen string) (board Chessboard, err error) {
 
 
   board = Chessboard{}
-  b, e := NewBook("/Users/vigneshv/bin/ProDeo.bin")
-
-  if e == nil {
-    board.book = *b
-  } else {
-    // fmt.Println("Could not load book.")
-  }
+  board.books = defaultBooks
 
   // Configure the board to have -1 (no piece) on
   // every square.
@@ -151,13 +151,147 @@ func NewChessboard(fen string) (board Chessboard, err error) {
   }
 
   board.enpassantPos = -1
-  if len(fenParts) > 3 {
+  if len(fenParts) > 3 && fenParts[3] != "-" {
     board.enpassantPos = alToPos(fenParts[3])
   }
 
+  board.fullmoveNumber = 1
+  if len(fenParts) > 4 {
+    board.halfmoveClock, _ = strconv.Atoi(fenParts[4])
+  }
+
+  if len(fenParts) > 5 {
+    if n, e := strconv.Atoi(fenParts[5]); e == nil && n > 0 {
+      board.fullmoveNumber = n
+    }
+  }
+
+  board.key = board.computeBookHash()
+
   return
 }
 
+// Returns a deep copy of the board, which can be moved on independently
+// of the original.
+func (c Chessboard) Copy() Chessboard {
+  n := c
+
+  n.boardSquares = make([]int8, len(c.boardSquares))
+  copy(n.boardSquares, c.boardSquares)
+
+  n.ksCanCastle = make([]bool, 2)
+  n.qsCanCastle = make([]bool, 2)
+  copy(n.ksCanCastle, c.ksCanCastle)
+  copy(n.qsCanCastle, c.qsCanCastle)
+
+  return n
+}
+
+// Returns the FEN string describing the current position.
+func (c Chessboard) Fen() string {
+  fen := ""
+
+  for r := 0; r < 8; r++ {
+    empty := 0
+
+    for col := 0; col < 8; col++ {
+      v := c.boardSquares[posFromRowColumn(r, col)]
+
+      if v == -1 {
+        empty += 1
+        continue
+      }
+
+      if empty > 0 {
+        fen += strconv.Itoa(empty)
+        empty = 0
+      }
+
+      for k, pv := range pieceVals {
+        if pv == v {
+          fen += k
+          break
+        }
+      }
+    }
+
+    if empty > 0 {
+      fen += strconv.Itoa(empty)
+    }
+
+    if r < 7 {
+      fen += "/"
+    }
+  }
+
+  if c.turn {
+    fen += " b "
+  } else {
+    fen += " w "
+  }
+
+  castling := ""
+  if c.ksCanCastle[0] {
+    castling += "K"
+  }
+
+  if c.qsCanCastle[0] {
+    castling += "Q"
+  }
+
+  if c.ksCanCastle[1] {
+    castling += "k"
+  }
+
+  if c.qsCanCastle[1] {
+    castling += "q"
+  }
+
+  if castling == "" {
+    castling = "-"
+  }
+
+  ep := "-"
+  if c.enpassantPos > -1 && c.enpassantPos < 64 {
+    ep = PosToAl(c.enpassantPos)
+  }
+
+  return fmt.Sprintf("%s%s %s %d %d", fen, castling, ep, c.halfmoveClock, c.fullmoveNumber)
+}
+
+// Returns the result of the game if the side to move has been checkmated or
+// stalemated ("1-0", "0-1" or "1/2-1/2"), otherwise "*".
+func (c Chessboard) GameResult() string {
+  if len(c.AllLegalMoves()) > 0 {
+    return "*"
+  }
+
+  color := 0
+  if c.turn {
+    color = 1
+  }
+
+  if !c.kingInCheck(color) {
+    return "1/2-1/2"
+  }
+
+  if c.turn {
+    return "1-0"
+  }
+
+  return "0-1"
+}
+
+// Returns true if it is black's turn to move.
+func (c Chessboard) BlackToMove() bool {
+  return c.turn
+}
+
+// Returns the current full move number, as it would appear in a FEN.
+func (c Chessboard) FullmoveNumber() int {
+  return c.fullmoveNumber
+}
+
 // Checks for promotion validity, does not take into account turn
 func (c Chessboard) attemptedPromotion(from int, to int) bool {
   color := c.pieceColorOnPosition(from)
@@ -184,16 +318,44 @@ func (c Chessboard) moveIsLegal(from int, to int, promopiece string) bool {
 }
 
 // Makes a move using algebraic descriptive notation.
-// Example: e2e4
+// Example: e2e4, or e7e8q for a promotion.
 func (c *Chessboard) MoveAlDescriptive(notation string) bool {
-  if len(notation) < 4 {
+  if len(notation) < 4 || len(notation) > 5 {
     return false
   }
 
   fromSquare := alToPos(notation[0:2])
-  toSquare := alToPos(notation[2:])
+  toSquare := alToPos(notation[2:4])
+
+  if fromSquare < 0 || fromSquare > 63 || toSquare < 0 || toSquare > 63 {
+    return false
+  }
+
+  if len(notation) == 5 && !strings.Contains("qrbn", notation[4:]) {
+    return false
+  }
 
-  return c.MakeMove(fromSquare, toSquare, "")
+  return c.MakeMove(fromSquare, toSquare, strings.ToUpper(notation[4:]))
+}
+
+// Returns the algebraic descriptive notation of a move given as a from
+// square, a to square and an optional promotion piece. Example: e7e8q
+func MoveToAl(move []int) string {
+  if len(move) < 2 {
+    return ""
+  }
+
+  al := PosToAl(move[0]) + PosToAl(move[1])
+
+  if len(move) > 2 {
+    for k, v := range pieceVals {
+      if int(v) == move[2] + 10 {
+        al += k
+      }
+    }
+  }
+
+  return al
 }
 
 // Moves from->to if the move is legal.
@@ -214,6 +376,9 @@ func (c *Chessboard) RestoreBoard(d RestoreData) {
   c.qsCanCastle[1] = d.qsCanCastle[1]
 
   c.enpassantPos = d.enpassantPos
+  c.halfmoveClock = d.halfmoveClock
+  c.fullmoveNumber = d.fullmoveNumber
+  c.key = d.key
   c.turn = !c.turn
 }
 
@@ -243,6 +408,10 @@ func (c *Chessboard) Move(from int, to int, promopiece string, dryrun bool) (boo
     return false, RestoreData{}
   }
 
+  // The en passant part of the key depends on the pawns next to the
+  // square, and is taken before they move.
+  preEpKey := c.enPassantKey(c.enpassantPos)
+
   preKsCanCastle := make([]bool, 2)
   preQsCanCastle := make([]bool, 2)
 
@@ -266,6 +435,15 @@ func (c *Chessboard) Move(from int, to int, promopiece string, dryrun bool) (boo
     }
   }
 
+  // Nor on the side where its rook has been captured.
+  if to == c.rookCastleKingsidePosition(1 - color) {
+    c.ksCanCastle[1 - color] = false
+  }
+
+  if to == c.rookCastleQueensidePosition(1 - color) {
+    c.qsCanCastle[1 - color] = false
+  }
+
   // Castling
   if c.castlingAttempt(color, from, to) {
     afterPos := c.rookPositionAfterCastle(color, from, to)
@@ -290,6 +468,9 @@ func (c *Chessboard) Move(from int, to int, promopiece string, dryrun bool) (boo
       }
   }
 
+  // Captures and pawn moves reset the fifty move counter.
+  resetsClock := c.validPiecePawn(from) || c.validPiece(to)
+
   // Set the enpassant position
   preEpPos := c.enpassantPos
   c.enpassantPos = c.generateEpPos(color, from, to)
@@ -316,7 +497,8 @@ func (c *Chessboard) Move(from int, to int, promopiece string, dryrun bool) (boo
 
   kingInCheck := c.kingInCheck(color)
 
-  restoreData := RestoreData{restoreMap, preEpPos, preKsCanCastle, preQsCanCastle}
+  restoreData := RestoreData{restoreMap, preEpPos, preKsCanCastle, preQsCanCastle,
+                             c.halfmoveClock, c.fullmoveNumber, c.key}
 
   // If the king is in check, or this is a dry run, reset the board.
   if kingInCheck || dryrun {
@@ -335,7 +517,26 @@ func (c *Chessboard) Move(from int, to int, promopiece string, dryrun bool) (boo
     return !kingInCheck, restoreData
   }
 
+  if resetsClock {
+    c.halfmoveClock = 0
+  } else {
+    c.halfmoveClock += 1
+  }
+
+  if color == 1 {
+    c.fullmoveNumber += 1
+  }
+
+  // The key is updated from the squares which changed, rather than
+  // computed again from the whole board.
+  key := c.key ^ castleKey(preKsCanCastle, preQsCanCastle) ^ preEpKey
+
+  for pos, piece := range restoreMap {
+    key ^= pieceKey(pos, piece) ^ pieceKey(pos, c.boardSquares[pos])
+  }
+
   c.turn = !c.turn
+  c.key = key ^ castleKey(c.ksCanCastle, c.qsCanCastle) ^ c.enPassantKey(c.enpassantPos) ^ randomTurn[0]
 
   return true, restoreData
 }
@@ -0,0 +1,232 @@
+package chessboard
+
+// Book learning. The engine records the book moves it plays during a game,
+// and once the game is over adjusts the learn values of those moves based on
+// the result and on the evaluation after leaving the book, so that losing
+// lines are played less often (and eventually not at all).
+import (
+  "encoding/binary"
+  "io/ioutil"
+  "os"
+)
+
+// Learn values are clamped to [-maxLearn, maxLearn].
+const maxLearn = 100
+
+// A book move played by the engine.
+type learnedMove struct {
+  book *OpeningBook
+  hash uint64
+  move uint16
+}
+
+// Records the book moves played by the engine in a game.
+type BookLearner struct {
+  UpdateWeights bool // Also adjust the weights of the moves, not only the learn values.
+  moves []learnedMove
+  color int // The engine's color, -1 if it has not moved yet.
+  outOfBook bool
+  leaveEval int // The evaluation of the first move after leaving the book.
+  lastEval int // The evaluation of the engine's last move.
+  final Chessboard // The position after the engine's last move.
+}
+
+// Creates a learner for a new game.
+func NewBookLearner() *BookLearner {
+  return &BookLearner{color: -1}
+}
+
+// Records a move played by the engine in the position c, along with its
+// evaluation in centipawns from the engine's point of view.
+func (l *BookLearner) RecordMove(c Chessboard, move []int, score int) {
+  if l.color == -1 {
+    l.color = 0
+
+    if c.turn {
+      l.color = 1
+    }
+  }
+
+  l.lastEval = score
+  l.final = c.Copy()
+  l.final.MakeMove(move[0], move[1], promoPieceString(move))
+
+  if l.outOfBook {
+    return
+  }
+
+  hash := c.BookHash()
+  encoded := c.encodeBookMove(move[0], move[1], promoPieceString(move))
+
+  for _, b := range c.books {
+    // Only polyglot books can learn, but a move from any other book still
+    // counts as a book move.
+    pb, ok := b.(*OpeningBook)
+
+    if !ok {
+      for _, e := range b.Probe(c) {
+        if e.Legal && MoveToAl(e.Move) == MoveToAl(move) {
+          return
+        }
+      }
+
+      continue
+    }
+
+    for _, e := range pb.lookup(hash) {
+      if e.Move == encoded {
+        l.moves = append(l.moves, learnedMove{pb, hash, encoded})
+        return
+      }
+    }
+  }
+
+  l.outOfBook = true
+  l.leaveEval = score
+}
+
+// Returns the result of the game from the engine's point of view (1 for a
+// win, 0.5 for a draw, 0 for a loss). If the game did not end on the board
+// with the engine's last move, the result is estimated from the engine's last
+// evaluation.
+func (l *BookLearner) Result() float64 {
+  if l.color == -1 {
+    return 0.5
+  }
+
+  switch l.final.GameResult() {
+  case "1-0":
+    return 1 - float64(l.color)
+  case "0-1":
+    return float64(l.color)
+  case "1/2-1/2":
+    return 0.5
+  }
+
+  if l.lastEval > 200 {
+    return 1
+  } else if l.lastEval < -200 {
+    return 0
+  }
+
+  return 0.5
+}
+
+// Updates the learn values of the recorded book moves for the result of the
+// game (from the engine's point of view), saves the books which have a learn
+// file, and resets the learner for a new game.
+func (l *BookLearner) Learn(result float64) error {
+  // A win or a loss counts for 10, the evaluation after leaving the book for
+  // up to 5 in either direction.
+  delta := int((result - 0.5) * 20)
+
+  if l.outOfBook {
+    delta += clamp(l.leaveEval / 50, -5, 5)
+  }
+
+  changed := make(map[*OpeningBook]bool)
+
+  for _, m := range l.moves {
+    if delta != 0 && m.book.updateLearn(m.hash, m.move, delta, l.UpdateWeights) {
+      changed[m.book] = true
+    }
+  }
+
+  *l = BookLearner{UpdateWeights: l.UpdateWeights, color: -1}
+
+  for b := range changed {
+    if b.learnFile == "" {
+      continue
+    }
+
+    if err := b.Save(b.learnFile); err != nil {
+      return err
+    }
+  }
+
+  return nil
+}
+
+// Sets the file learned values are saved to. The book is a writable copy of
+// the original, so the file should not be the book the original was loaded
+// from.
+func (b *OpeningBook) SetLearnFile(name string) {
+  b.learnFile = name
+}
+
+// Adds delta to the learn value of the entry for the given hash and move,
+// and optionally adjusts its weight by the same percentage. Returns false if
+// there is no such entry.
+func (b *OpeningBook) updateLearn(hash uint64, move uint16, delta int, updateWeight bool) bool {
+  b.mu.Lock()
+  defer b.mu.Unlock()
+
+  for i := b.search(hash); i < b.entries; i++ {
+    e := b.entry(i)
+
+    if e.Key != hash {
+      break
+    }
+
+    if e.Move != move {
+      continue
+    }
+
+    d := b.data[i * 16 : (i + 1) * 16]
+    binary.BigEndian.PutUint32(d[12:16], uint32(int32(clamp(e.learnValue() + delta, -maxLearn, maxLearn))))
+
+    if updateWeight {
+      weight := clamp(int(e.Score) * (100 + delta) / 100, 1, 0xFFFF)
+      binary.BigEndian.PutUint16(d[10:12], uint16(weight))
+    }
+
+    return true
+  }
+
+  return false
+}
+
+// Writes the book, including anything learned, to the given file.
+func (b *OpeningBook) Save(name string) error {
+  b.mu.RLock()
+  defer b.mu.RUnlock()
+
+  // Write to a temporary file first, so that an interrupted save never
+  // leaves a truncated book behind.
+  tmp := name + ".tmp"
+
+  if err := ioutil.WriteFile(tmp, b.data, 0644); err != nil {
+    return err
+  }
+
+  return os.Rename(tmp, name)
+}
+
+// Returns the promotion piece of a move as used by MakeMove, "" if the move
+// is not a promotion.
+func promoPieceString(move []int) string {
+  if len(move) < 3 {
+    return ""
+  }
+
+  for k, v := range pieceVals {
+    if int(v) == move[2] {
+      return k
+    }
+  }
+
+  return ""
+}
+
+// Clamps n to the range [min, max].
+func clamp(n int, min int, max int) int {
+  if n < min {
+    return min
+  }
+
+  if n > max {
+    return max
+  }
+
+  return n
+}
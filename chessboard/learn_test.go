@@ -0,0 +1,164 @@
+package chessboard
+
+import (
+  "path/filepath"
+  "testing"
+)
+
+const startKey = 0x463b96181691fc9c
+
+var e2e4 = polyglotMove(4, 1, 4, 3, 0)
+var d2d4 = polyglotMove(3, 1, 3, 3, 0)
+
+// Returns the learn field of an entry holding the given learn value.
+func learnBits(learn int32) uint32 {
+  return uint32(learn)
+}
+
+// A book with 1. e4 and 1. d4, the learn value of 1. e4 being given.
+func learnBook(t *testing.T, learn int32) *OpeningBook {
+  return bookFromEntries(t, []Entry{
+    {Key: startKey, Move: e2e4, Score: 100, Learn: learnBits(learn)},
+    {Key: startKey, Move: d2d4, Score: 50},
+  })
+}
+
+// Returns the entry of the book for 1. e4.
+func e2e4Entry(t *testing.T, b *OpeningBook) Entry {
+  for _, e := range b.lookup(startKey) {
+    if e.Move == e2e4 {
+      return e
+    }
+  }
+
+  t.Fatal("1. e4 is not in the book")
+  return Entry{}
+}
+
+func TestBookLearn(t *testing.T) {
+  cases := []struct {
+    name string
+    result float64
+    updateWeights bool
+    learn int32
+    wantLearn int
+    wantWeight int
+  }{
+    {"win", 1, false, 0, 10, 100},
+    {"loss", 0, false, 0, -10, 100},
+    {"draw", 0.5, false, 0, 0, 100},
+    {"win with weights", 1, true, 0, 10, 110},
+    {"loss with weights", 0, true, 0, -10, 90},
+    {"win clamped", 1, false, 95, 100, 100},
+    {"loss clamped", 0, false, -95, -100, 100},
+  }
+
+  for _, tc := range cases {
+    book := learnBook(t, tc.learn)
+    board := boardFromFen(t, startFen)
+    board.SetBooks(book)
+
+    l := NewBookLearner()
+    l.UpdateWeights = tc.updateWeights
+    l.RecordMove(board, []int{alToPos("e2"), alToPos("e4")}, 0)
+
+    if err := l.Learn(tc.result); err != nil {
+      t.Fatal(err)
+    }
+
+    e := e2e4Entry(t, book)
+
+    if e.learnValue() != tc.wantLearn || int(e.Score) != tc.wantWeight {
+      t.Errorf("%s: learn %d and weight %d, want %d and %d", tc.name, e.learnValue(), e.Score,
+               tc.wantLearn, tc.wantWeight)
+    }
+  }
+}
+
+func TestBookLearnerResult(t *testing.T) {
+  // Fool's mate, played by the engine.
+  board := boardFromFen(t, "rnbqkbnr/pppp1ppp/8/4p3/6P1/5P2/PPPPP2P/RNBQKBNR b KQkq g3 0 2")
+
+  l := NewBookLearner()
+  l.RecordMove(board, []int{alToPos("d8"), alToPos("h4")}, 0)
+
+  if result := l.Result(); result != 1 {
+    t.Errorf("mate: result %v, want 1", result)
+  }
+
+  if result := NewBookLearner().Result(); result != 0.5 {
+    t.Errorf("no moves: result %v, want 0.5", result)
+  }
+
+  // Games which did not end on the board are judged by the last evaluation.
+  for _, tc := range []struct {
+    score int
+    want float64
+  }{{300, 1}, {-300, 0}, {100, 0.5}} {
+    l := NewBookLearner()
+    l.RecordMove(boardFromFen(t, startFen), []int{alToPos("e2"), alToPos("e4")}, tc.score)
+
+    if result := l.Result(); result != tc.want {
+      t.Errorf("score %d: result %v, want %v", tc.score, result, tc.want)
+    }
+  }
+}
+
+// Learn values written by other programs are clamped, so that they cannot
+// inflate the weights of the moves.
+func TestBookLearnValueClamped(t *testing.T) {
+  book := bookFromEntries(t, []Entry{
+    {Key: startKey, Move: e2e4, Score: 100, Learn: learnBits(-1000)},
+    {Key: startKey, Move: d2d4, Score: 50, Learn: learnBits(1 << 30)},
+  })
+
+  probed := book.Probe(boardFromFen(t, startFen))
+
+  if len(probed) != 2 || MoveToAl(probed[0].Move) != "d2d4" || probed[0].Learn != 100 ||
+     MoveToAl(probed[1].Move) != "e2e4" || probed[1].Learn != -100 {
+    t.Errorf("probed %+v", probed)
+  }
+
+  if m := pickBookMove(book, boardFromFen(t, startFen)); MoveToAl(m) != "d2d4" {
+    t.Errorf("book move %s, want d2d4", MoveToAl(m))
+  }
+}
+
+// A book saved after learning loads back with what was learned.
+func TestBookLearnSave(t *testing.T) {
+  name := filepath.Join(t.TempDir(), "learned.bin")
+
+  book := learnBook(t, 0)
+  book.SetLearnFile(name)
+
+  board := boardFromFen(t, startFen)
+  board.SetBooks(book)
+
+  l := NewBookLearner()
+  l.RecordMove(board, []int{alToPos("e2"), alToPos("e4")}, 0)
+
+  if err := l.Learn(1); err != nil {
+    t.Fatal(err)
+  }
+
+  loaded, err := LoadBook(name)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  want, got := book.Entries(), loaded.Entries()
+
+  if len(got) != len(want) {
+    t.Fatalf("entries %v, want %v", got, want)
+  }
+
+  for i := range want {
+    if got[i] != want[i] {
+      t.Errorf("entry %d: %+v, want %+v", i, got[i], want[i])
+    }
+  }
+
+  if e := e2e4Entry(t, loaded.(*OpeningBook)); e.learnValue() != 10 {
+    t.Errorf("learn %d, want 10", e.learnValue())
+  }
+}
@@ -0,0 +1,222 @@
+package chessboard
+
+// Produces the moves of a position one at a time, in the order described in
+// ordering.go. Moves are generated in stages, and only when the previous
+// stages are exhausted, so that no time is spent generating and sorting
+// quiet moves at nodes where the hash move or a capture cuts off. The moves
+// are pseudo-legal: they are only checked for legality when they are made.
+
+// The stages of a move picker, in order.
+const (
+  stageHashMove = iota
+  stageGenCaptures
+  stageGoodCaptures
+  stageRefutations
+  stageGenQuiets
+  stageQuiets
+  stageBadCaptures
+  stageDone
+)
+
+type movePicker struct {
+  c *Chessboard
+  s *searchState
+  ply int
+  prev []int // The move which led to the position, nil at the root.
+  stage int
+  hashMove []int
+  refutations []uint16 // Killers and the countermove, tried after the good captures.
+  moves [][]int // The moves of the current stage.
+  scores []int
+  index int
+  badCaptures [][]int
+}
+
+// Creates a picker for the moves of the position c at the given ply.
+func (s *searchState) newMovePicker(c *Chessboard, hashMove []int, ply int, prev []int) *movePicker {
+  return &movePicker{c: c, s: s, ply: ply, prev: prev, hashMove: hashMove}
+}
+
+// Returns the next move to search, or nil once every move has been
+// returned.
+func (p *movePicker) next() []int {
+  c := p.c
+
+  for {
+    switch p.stage {
+    case stageHashMove:
+      p.stage += 1
+
+      if p.hashMove != nil && c.pseudoLegal(p.hashMove) {
+        return p.hashMove
+      }
+    case stageGenCaptures:
+      p.moves = c.tacticalMoves()
+      p.scores = make([]int, len(p.moves))
+
+      for i, m := range p.moves {
+        p.scores[i] = c.mvvLva(m)
+      }
+
+      p.index = 0
+      p.stage += 1
+    case stageGoodCaptures:
+      if m := p.pickBest(); m != nil {
+        if p.isHashMove(m) {
+          continue
+        }
+
+        // Captures losing material are left for the end.
+        if !c.attemptedPromotion(m[0], m[1]) && c.see(m[0], m[1]) < 0 {
+          p.badCaptures = append(p.badCaptures, m)
+          continue
+        }
+
+        return m
+      }
+
+      p.refutations = p.s.refutations(c, p.ply, p.prev)
+      p.index = 0
+      p.stage += 1
+    case stageRefutations:
+      if p.index < len(p.refutations) {
+        packed := p.refutations[p.index]
+        p.index += 1
+
+        // Killers come from other positions, and may not even be moves
+        // here. Captures were already searched.
+        m := unpackMove(packed)
+
+        if m == nil || p.isHashMove(m) || p.isDuplicateRefutation(p.index - 1) ||
+           !c.pseudoLegal(m) || c.isTactical(m) {
+          continue
+        }
+
+        return m
+      }
+
+      p.stage += 1
+    case stageGenQuiets:
+      p.moves = c.quietMoves()
+      p.scores = make([]int, len(p.moves))
+
+      for i, m := range p.moves {
+        p.scores[i] = p.s.quietScore(c, m, p.prev)
+      }
+
+      p.index = 0
+      p.stage += 1
+    case stageQuiets:
+      if m := p.pickBest(); m != nil {
+        if p.isHashMove(m) || p.isRefutation(m) {
+          continue
+        }
+
+        return m
+      }
+
+      p.index = 0
+      p.stage += 1
+    case stageBadCaptures:
+      if p.index < len(p.badCaptures) {
+        p.index += 1
+        return p.badCaptures[p.index - 1]
+      }
+
+      p.stage += 1
+    default:
+      return nil
+    }
+  }
+}
+
+// Returns the remaining move of the current stage with the highest score,
+// nil if there is none. The moves are selected one at a time rather than
+// sorted, since most nodes only need the first few.
+func (p *movePicker) pickBest() []int {
+  if p.index >= len(p.moves) {
+    return nil
+  }
+
+  best := p.index
+  for i := p.index + 1; i < len(p.moves); i++ {
+    if p.scores[i] > p.scores[best] {
+      best = i
+    }
+  }
+
+  p.moves[p.index], p.moves[best] = p.moves[best], p.moves[p.index]
+  p.scores[p.index], p.scores[best] = p.scores[best], p.scores[p.index]
+  p.index += 1
+
+  return p.moves[p.index - 1]
+}
+
+func (p *movePicker) isHashMove(m []int) bool {
+  return p.hashMove != nil && packMove(m) == packMove(p.hashMove)
+}
+
+// Returns true if the move was already returned as a killer or countermove.
+// Only called for quiet moves, which are all pseudo-legal.
+func (p *movePicker) isRefutation(m []int) bool {
+  packed := packMove(m)
+
+  for _, r := range p.refutations {
+    if r == packed {
+      return true
+    }
+  }
+
+  return false
+}
+
+// Returns true if the refutation at index i also appears before it.
+func (p *movePicker) isDuplicateRefutation(i int) bool {
+  for _, r := range p.refutations[:i] {
+    if r == p.refutations[i] {
+      return true
+    }
+  }
+
+  return false
+}
+
+// Returns the moves of the side to move which are neither captures nor
+// promotions, including castling. The moves may leave the king in check.
+func (c Chessboard) quietMoves() [][]int {
+  moves := make([][]int, 0, 32)
+
+  color := 0
+  if c.turn {
+    color = 1
+  }
+
+  for from := 0; from < 64; from++ {
+    if !c.validColorPiece(from, color) {
+      continue
+    }
+
+    for _, to := range c.candSquares(from) {
+      if !c.isTactical([]int{from, to}) && c.prelimValidMove(from, to) {
+        moves = append(moves, []int{from, to})
+      }
+    }
+  }
+
+  return moves
+}
+
+// Returns true if the move is a move of a piece of the side to move which
+// follows the rules of its piece, ignoring checks.
+func (c Chessboard) pseudoLegal(m []int) bool {
+  color := 0
+  if c.turn {
+    color = 1
+  }
+
+  if m[0] < 0 || m[0] > 63 || m[1] < 0 || m[1] > 63 || !c.validColorPiece(m[0], color) {
+    return false
+  }
+
+  return c.prelimValidMove(m[0], m[1])
+}
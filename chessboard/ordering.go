@@ -0,0 +1,150 @@
+package chessboard
+
+// Move ordering. Alpha-beta cuts off the most when the best move is searched
+// first, so moves are tried in order of how likely they are to be good: the
+// hash move, captures which win material, killer moves, the countermove,
+// quiet moves by their history, and finally captures which lose material.
+// The moves are produced in that order by the movePicker, using the tables
+// kept here.
+
+// History scores are kept within [-maxHistory, maxHistory].
+const maxHistory = 1 << 14
+
+// Statistics of a search, used to measure the quality of the move ordering.
+type SearchStats struct {
+  Nodes int
+  Cutoffs int // Nodes where a move failed high.
+  FirstMoveCutoffs int // Cutoffs caused by the first move searched.
+}
+
+// Returns the percentage of cutoffs caused by the first move searched.
+func (st SearchStats) FirstMoveCutoffRate() float64 {
+  if st.Cutoffs == 0 {
+    return 0
+  }
+
+  return 100 * float64(st.FirstMoveCutoffs) / float64(st.Cutoffs)
+}
+
+var lastSearchStats SearchStats
+
+// Returns the statistics of the last search run by AlphaBeta.
+func LastSearchStats() SearchStats {
+  return lastSearchStats
+}
+
+// The tables used to order quiet moves, which learn from the cutoffs of the
+// search. A Searcher keeps them from one search to the next.
+type moveHistory struct {
+  killers [maxPly][2]uint16 // Quiet moves which caused a cutoff at each ply.
+  history [2][64][64]int // By color, from and to square.
+  counterMoves [12][64]uint16 // The move which refuted a move, by its piece and to square.
+  continuation [12][64][12][64]int32 // By the previous move's piece and to square, then the move's.
+}
+
+// Prepares the tables kept from the previous search for a new one. The
+// killers were found at the plies of the previous search and are cleared,
+// and the histories are halved, so that the cutoffs of the new search soon
+// count more than the old ones.
+func (h *moveHistory) age() {
+  h.killers = [maxPly][2]uint16{}
+
+  for color := range h.history {
+    for from := range h.history[color] {
+      for to := range h.history[color][from] {
+        h.history[color][from][to] /= 2
+      }
+    }
+  }
+
+  for prevPiece := range h.continuation {
+    for prevTo := range h.continuation[prevPiece] {
+      for piece := range h.continuation[prevPiece][prevTo] {
+        for to := range h.continuation[prevPiece][prevTo][piece] {
+          h.continuation[prevPiece][prevTo][piece][to] /= 2
+        }
+      }
+    }
+  }
+}
+
+// Returns the index of a piece in the history tables.
+func pieceIndex(piece int8) int {
+  return int(piece / 10) * 6 + int(piece % 10) - 1
+}
+
+// Returns the score of a quiet move from its history and its continuation
+// history after prev, the move which led to the position (nil at the root).
+func (s *searchState) quietScore(c *Chessboard, m []int, prev []int) int {
+  h := s.history
+  piece := pieceIndex(c.boardSquares[m[0]])
+  score := h.history[piece / 6][m[0]][m[1]]
+
+  if prev != nil {
+    prevPiece := pieceIndex(c.boardSquares[prev[1]])
+    score += int(h.continuation[prevPiece][prev[1]][piece][m[1]])
+  }
+
+  return score
+}
+
+// Returns the quiet moves which refuted other moves recently: the killers
+// of the ply, then the countermove of prev. They may not be legal in the
+// position.
+func (s *searchState) refutations(c *Chessboard, ply int, prev []int) []uint16 {
+  h := s.history
+  moves := []uint16{h.killers[ply][0], h.killers[ply][1]}
+
+  if prev != nil {
+    moves = append(moves, h.counterMoves[pieceIndex(c.boardSquares[prev[1]])][prev[1]])
+  }
+
+  return moves
+}
+
+// Updates the history after the quiet move best caused a cutoff: it becomes
+// a killer and the countermove of prev, its history is raised, and the
+// history of the quiet moves searched before it is lowered.
+func (s *searchState) updateQuietHistory(c *Chessboard, best []int, tried [][]int, depth int, ply int, prev []int) {
+  h := s.history
+  packed := packMove(best)
+
+  if h.killers[ply][0] != packed {
+    h.killers[ply][1] = h.killers[ply][0]
+    h.killers[ply][0] = packed
+  }
+
+  prevPiece := -1
+  if prev != nil {
+    prevPiece = pieceIndex(c.boardSquares[prev[1]])
+    h.counterMoves[prevPiece][prev[1]] = packed
+  }
+
+  bonus := depth * depth
+  if bonus > 400 {
+    bonus = 400
+  }
+
+  for _, m := range tried {
+    delta := -bonus
+    if packMove(m) == packed {
+      delta = bonus
+    }
+
+    piece := pieceIndex(c.boardSquares[m[0]])
+    updateHistory(&h.history[piece / 6][m[0]][m[1]], delta)
+
+    if prevPiece != -1 {
+      v := int(h.continuation[prevPiece][prev[1]][piece][m[1]])
+      updateHistory(&v, delta)
+      h.continuation[prevPiece][prev[1]][piece][m[1]] = int32(v)
+    }
+  }
+}
+
+// Adds delta to a history score. The closer the score is to the maximum,
+// the less it changes, so that scores stay within [-maxHistory, maxHistory]
+// and recent cutoffs count more than old ones.
+func updateHistory(score *int, delta int) {
+  *score += 32 * delta - *score * abs(delta) / (maxHistory / 32)
+}
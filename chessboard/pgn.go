@@ -0,0 +1,549 @@
+package chessboard
+
+// Streaming reader for PGN (Portable Game Notation) files. Games are read one
+// at a time, so arbitrarily large collections can be processed without
+// holding more than a single game in memory.
+import (
+  "bufio"
+  "fmt"
+  "io"
+  "regexp"
+  "strconv"
+  "strings"
+)
+
+// The seven tag roster, in the order it should appear in a PGN file.
+var sevenTagRoster = []string{"Event", "Site", "Date", "Round", "White", "Black", "Result"}
+
+// Maps the traditional move suffix annotations to their NAG values.
+var suffixNAGs = map[string]int{
+  "!": 1,
+  "?": 2,
+  "!!": 3,
+  "??": 4,
+  "!?": 5,
+  "?!": 6,
+}
+
+// Matches the embedded [%eval ...] and [%clk ...] commands of a comment.
+var commentCommandPattern = regexp.MustCompile(`\[%(eval|clk)\s+([^\]]*)\]`)
+
+// A single move of a game, along with the annotations attached to it.
+type PGNMove struct {
+  SAN string
+  From int
+  To int
+  Promotion string
+  Eval string // The [%eval] value, e.g. "0.35" or "#-3".
+  Clock string // The [%clk] value, e.g. "1:25:03".
+  NAGs []int
+  PreComments []string // Comments appearing before the move (variation starts).
+  Comments []string // Comments appearing after the move.
+  Variations [][]*PGNMove // Alternatives to this move.
+}
+
+// A game read from a PGN file. Tags holds every tag pair, TagOrder the order
+// in which they appeared.
+type PGNGame struct {
+  Tags map[string]string
+  TagOrder []string
+  Comments []string // Comments appearing before the first move.
+  Moves []*PGNMove
+  Result string
+}
+
+// Describes a problem in a PGN file, including the location of the offending
+// token and, for illegal moves, the ply at which it was played.
+type PGNError struct {
+  Game int
+  Line int
+  Column int
+  Ply int
+  Move string
+  Msg string
+}
+
+func (e *PGNError) Error() string {
+  if e.Move != "" {
+    return fmt.Sprintf("pgn: game %d, line %d, column %d: ply %d (%s): %s",
+                       e.Game, e.Line, e.Column, e.Ply, e.Move, e.Msg)
+  }
+
+  return fmt.Sprintf("pgn: game %d, line %d, column %d: %s", e.Game, e.Line, e.Column, e.Msg)
+}
+
+// Creates an empty game with no tags.
+func NewPGNGame() *PGNGame {
+  return &PGNGame{Tags: make(map[string]string), Result: "*"}
+}
+
+// Returns the value of a tag, or "" if it is not present.
+func (g *PGNGame) Tag(name string) string {
+  return g.Tags[name]
+}
+
+// Sets the value of a tag, keeping track of the order of insertion.
+func (g *PGNGame) SetTag(name string, value string) {
+  if _, ok := g.Tags[name]; !ok {
+    g.TagOrder = append(g.TagOrder, name)
+  }
+
+  g.Tags[name] = value
+}
+
+// Returns the position the game starts from, taking into account the FEN
+// and SetUp tags.
+func (g *PGNGame) StartingBoard() (Chessboard, error) {
+  if fen := g.Tag("FEN"); fen != "" && g.Tag("SetUp") != "0" {
+    return NewChessboard(fen)
+  }
+
+  return NewChessboard(startFen)
+}
+
+// Returns the position at the end of the main line.
+func (g *PGNGame) FinalBoard() (Chessboard, error) {
+  board, err := g.StartingBoard()
+
+  if err != nil {
+    return board, err
+  }
+
+  for _, m := range g.Moves {
+    if !board.MakeMove(m.From, m.To, m.Promotion) {
+      return board, fmt.Errorf("Illegal move %s.", m.SAN)
+    }
+  }
+
+  return board, nil
+}
+
+const (
+  tokenEOF = iota
+  tokenTagOpen
+  tokenTagClose
+  tokenString
+  tokenSymbol
+  tokenPeriod
+  tokenNAG
+  tokenComment
+  tokenVariationOpen
+  tokenVariationClose
+  tokenResult
+)
+
+type pgnToken struct {
+  kind int
+  text string
+  line int
+  col int
+}
+
+// Reads games one at a time from an underlying reader.
+type PGNReader struct {
+  r *bufio.Reader
+  line int
+  col int
+  games int
+  peeked *pgnToken
+}
+
+// Creates a reader for the PGN stream r.
+func NewPGNReader(r io.Reader) *PGNReader {
+  return &PGNReader{r: bufio.NewReaderSize(r, 64 * 1024), line: 1}
+}
+
+// Reads the next game of the stream. Returns io.EOF once there are no more
+// games. If the game contains an illegal move, the game is still read in
+// full, and returned with the moves up to the illegal one along with a
+// *PGNError describing it, so the caller may choose to skip it and continue.
+func (p *PGNReader) Next() (*PGNGame, error) {
+  tok, err := p.next()
+
+  if err != nil {
+    return nil, err
+  }
+
+  // Skip anything in between games that is not a tag or movetext.
+  for tok.kind == tokenTagClose || tok.kind == tokenString ||
+      tok.kind == tokenVariationClose {
+    if tok, err = p.next(); err != nil {
+      return nil, err
+    }
+  }
+
+  if tok.kind == tokenEOF {
+    return nil, io.EOF
+  }
+
+  p.games += 1
+  game := NewPGNGame()
+
+  for tok.kind == tokenTagOpen {
+    if err = p.readTag(game); err != nil {
+      return nil, err
+    }
+
+    if tok, err = p.next(); err != nil {
+      return nil, err
+    }
+  }
+
+  p.peeked = &tok
+
+  board, e := game.StartingBoard()
+  if e != nil {
+    err = &PGNError{Game: p.games, Line: tok.line, Column: tok.col, Msg: "invalid FEN tag: " + e.Error()}
+  }
+
+  game.Moves, tok, err = p.readLine(game, board, 0, err)
+
+  if tok.kind == tokenResult {
+    game.Result = tok.text
+  } else if result := game.Tag("Result"); result != "" {
+    game.Result = result
+  }
+
+  if game.Tag("Result") == "" {
+    game.SetTag("Result", game.Result)
+  }
+
+  return game, err
+}
+
+// Reads the name and value of a tag pair, after the opening bracket.
+func (p *PGNReader) readTag(game *PGNGame) error {
+  name, err := p.next()
+  if err != nil {
+    return err
+  }
+
+  value, err := p.next()
+  if err != nil {
+    return err
+  }
+
+  end, err := p.next()
+  if err != nil {
+    return err
+  }
+
+  if name.kind != tokenSymbol || value.kind != tokenString || end.kind != tokenTagClose {
+    return &PGNError{Game: p.games, Line: name.line, Column: name.col, Msg: "malformed tag pair"}
+  }
+
+  game.SetTag(name.text, value.text)
+
+  return nil
+}
+
+// Reads a line of moves (either the main line or a variation) played from
+// board, returning the moves and the token which ended the line. Once an
+// error has occurred, the remaining moves are read but no longer replayed.
+// An error in a variation does not stop the line itself from being
+// replayed, and is only returned when the line has no error of its own.
+func (p *PGNReader) readLine(game *PGNGame, board Chessboard, depth int, err error) ([]*PGNMove, pgnToken, error) {
+  moves := make([]*PGNMove, 0, 80)
+  var last *PGNMove
+  var prev Chessboard
+  var pending []string
+  var varErr error
+
+  // Variations found before the first move of the line are alternatives to
+  // that move.
+  var leading [][]*PGNMove
+
+  // Returns the error of the line ended by tok, or else the first error of
+  // its variations.
+  lineErr := func(tok pgnToken) error {
+    if err != nil {
+      return err
+    }
+
+    if varErr == nil && len(leading) > 0 {
+      varErr = &PGNError{Game: p.games, Line: tok.line, Column: tok.col,
+                         Msg: "variation is not followed by the move it replaces"}
+    }
+
+    return varErr
+  }
+
+  for {
+    tok, e := p.next()
+
+    if e != nil {
+      return moves, tok, e
+    }
+
+    switch tok.kind {
+    case tokenEOF, tokenResult:
+      return moves, tok, lineErr(tok)
+    case tokenTagOpen:
+      // A missing game termination, the next game has begun.
+      p.peeked = &tok
+      return moves, tok, lineErr(tok)
+    case tokenVariationClose:
+      if depth > 0 {
+        return moves, tok, lineErr(tok)
+      }
+    case tokenVariationOpen:
+      var variation []*PGNMove
+      var end pgnToken
+
+      if last == nil {
+        variation, end, e = p.readLine(game, board.Copy(), depth + 1, err)
+      } else {
+        variation, end, e = p.readLine(game, prev.Copy(), depth + 1, err)
+      }
+
+      if e != nil && varErr == nil {
+        varErr = e
+      }
+
+      if len(variation) > 0 {
+        if last == nil {
+          leading = append(leading, variation)
+        } else {
+          last.Variations = append(last.Variations, variation)
+        }
+      }
+
+      if end.kind != tokenVariationClose {
+        return moves, end, lineErr(end)
+      }
+    case tokenComment:
+      if last != nil {
+        for _, cmd := range commentCommandPattern.FindAllStringSubmatch(tok.text, -1) {
+          if cmd[1] == "eval" {
+            last.Eval = strings.TrimSpace(cmd[2])
+          } else {
+            last.Clock = strings.TrimSpace(cmd[2])
+          }
+        }
+
+        text := strings.TrimSpace(commentCommandPattern.ReplaceAllString(tok.text, ""))
+        if text != "" {
+          last.Comments = append(last.Comments, strings.Join(strings.Fields(text), " "))
+        }
+      } else if depth == 0 && len(game.Comments) == 0 && len(pending) == 0 {
+        game.Comments = append(game.Comments, tok.text)
+      } else {
+        pending = append(pending, tok.text)
+      }
+    case tokenNAG:
+      if last != nil {
+        last.NAGs = append(last.NAGs, p.nagValue(tok))
+      }
+    case tokenSymbol:
+      // Move numbers are implied by the move list.
+      if _, e := strconv.Atoi(tok.text); e == nil {
+        continue
+      }
+
+      if err != nil {
+        continue
+      }
+
+      from, to, promopiece, e := board.ParseSAN(tok.text)
+
+      if e == nil {
+        prev = board.Copy()
+
+        if !board.MakeMove(from, to, promopiece) {
+          e = fmt.Errorf("Illegal move %s.", tok.text)
+        }
+      }
+
+      if e != nil {
+        ply := 2 * (board.fullmoveNumber - 1) + 1
+        if board.turn {
+          ply += 1
+        }
+
+        err = &PGNError{Game: p.games, Line: tok.line, Column: tok.col,
+                        Ply: ply, Move: tok.text, Msg: e.Error()}
+        continue
+      }
+
+      last = &PGNMove{SAN: tok.text, From: from, To: to, Promotion: promopiece,
+                      PreComments: pending, Variations: leading}
+      pending = nil
+      leading = nil
+      moves = append(moves, last)
+    }
+  }
+}
+
+// Returns the value of a NAG token, which is either of the form $n or a
+// suffix annotation.
+func (p *PGNReader) nagValue(tok pgnToken) int {
+  if nag, ok := suffixNAGs[tok.text]; ok {
+    return nag
+  }
+
+  n, _ := strconv.Atoi(strings.TrimPrefix(tok.text, "$"))
+  return n
+}
+
+// Reads a single rune, keeping track of the line and column.
+func (p *PGNReader) readRune() (rune, error) {
+  r, _, err := p.r.ReadRune()
+
+  if err != nil {
+    return r, err
+  }
+
+  if r == '\n' {
+    p.line += 1
+    p.col = 0
+  } else {
+    p.col += 1
+  }
+
+  return r, nil
+}
+
+// Returns the next rune without consuming it, or 0 at the end of input.
+func (p *PGNReader) peekRune() rune {
+  r, _, err := p.r.ReadRune()
+
+  if err != nil {
+    return 0
+  }
+
+  p.r.UnreadRune()
+  return r
+}
+
+// Reads until the given delimiter, returning everything read before it.
+func (p *PGNReader) readUntil(delim rune) (string, error) {
+  var sb strings.Builder
+
+  for {
+    r, err := p.readRune()
+
+    if err != nil || r == delim {
+      return sb.String(), err
+    }
+
+    sb.WriteRune(r)
+  }
+}
+
+// Returns the next token of the stream.
+func (p *PGNReader) next() (pgnToken, error) {
+  if p.peeked != nil {
+    tok := *p.peeked
+    p.peeked = nil
+    return tok, nil
+  }
+
+  for {
+    r, err := p.readRune()
+
+    if err == io.EOF {
+      return pgnToken{kind: tokenEOF, line: p.line, col: p.col}, nil
+    } else if err != nil {
+      return pgnToken{}, err
+    }
+
+    tok := pgnToken{line: p.line, col: p.col}
+
+    switch {
+    case r == ' ' || r == '\t' || r == '\r' || r == '\n' || r == '\uFEFF':
+      continue
+    case r == '%' && p.col == 1:
+      // Escaped lines are ignored.
+      if _, err = p.readUntil('\n'); err != nil && err != io.EOF {
+        return tok, err
+      }
+
+      continue
+    case r == '[':
+      tok.kind = tokenTagOpen
+    case r == ']':
+      tok.kind = tokenTagClose
+    case r == '(':
+      tok.kind = tokenVariationOpen
+    case r == ')':
+      tok.kind = tokenVariationClose
+    case r == '.':
+      tok.kind = tokenPeriod
+    case r == '*':
+      tok.kind, tok.text = tokenResult, "*"
+    case r == '{':
+      tok.kind = tokenComment
+      tok.text, err = p.readUntil('}')
+      tok.text = strings.Join(strings.Fields(tok.text), " ")
+    case r == ';':
+      tok.kind = tokenComment
+      tok.text, err = p.readUntil('\n')
+      tok.text = strings.TrimSpace(tok.text)
+    case r == '"':
+      tok.kind = tokenString
+      tok.text, err = p.readString()
+    case r == '$':
+      tok.kind = tokenNAG
+      tok.text = "$" + p.readWhile(func(r rune) bool { return r >= '0' && r <= '9' })
+    case r == '!' || r == '?':
+      tok.kind = tokenNAG
+      tok.text = string(r) + p.readWhile(func(r rune) bool { return r == '!' || r == '?' })
+    case isSymbolRune(r):
+      tok.kind = tokenSymbol
+      tok.text = string(r) + p.readWhile(isSymbolRune)
+
+      switch tok.text {
+      case "1-0", "0-1", "1/2-1/2":
+        tok.kind = tokenResult
+      }
+    default:
+      continue
+    }
+
+    if err == io.EOF {
+      err = nil
+    }
+
+    return tok, err
+  }
+}
+
+// Reads a quoted string after its opening quote, handling escapes.
+func (p *PGNReader) readString() (string, error) {
+  var sb strings.Builder
+
+  for {
+    r, err := p.readRune()
+
+    if err != nil || r == '"' || r == '\n' {
+      return sb.String(), err
+    }
+
+    if r == '\\' {
+      if r, err = p.readRune(); err != nil {
+        return sb.String(), err
+      }
+    }
+
+    sb.WriteRune(r)
+  }
+}
+
+// Reads runes while they satisfy f.
+func (p *PGNReader) readWhile(f func(rune) bool) string {
+  var sb strings.Builder
+
+  for r := p.peekRune(); r != 0 && f(r); r = p.peekRune() {
+    p.readRune()
+    sb.WriteRune(r)
+  }
+
+  return sb.String()
+}
+
+// Checks whether r may be part of a symbol token (moves, move numbers,
+// results and tag names).
+func isSymbolRune(r rune) bool {
+  return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') ||
+    (r >= '0' && r <= '9') || strings.ContainsRune("_+#=:-/", r)
+}
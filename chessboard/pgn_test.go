@@ -0,0 +1,281 @@
+package chessboard
+
+import (
+  "io"
+  "reflect"
+  "strings"
+  "testing"
+)
+
+// Reads every game of the PGN text, failing on any error.
+func readPGN(t *testing.T, pgn string) []*PGNGame {
+  var games []*PGNGame
+  r := NewPGNReader(strings.NewReader(pgn))
+
+  for {
+    game, err := r.Next()
+
+    if err == io.EOF {
+      return games
+    } else if err != nil {
+      t.Fatalf("%q: %v", pgn, err)
+    }
+
+    games = append(games, game)
+  }
+}
+
+// Returns the SAN of the moves.
+func sans(moves []*PGNMove) []string {
+  list := make([]string, len(moves))
+  for i, m := range moves {
+    list[i] = m.SAN
+  }
+
+  return list
+}
+
+func TestPGNTags(t *testing.T) {
+  games := readPGN(t, `[Event "Test \"quoted\""]
+[Site "Here"]
+[Result "1-0"]
+
+1. e4 e5 1-0
+`)
+
+  if len(games) != 1 {
+    t.Fatalf("%d games", len(games))
+  }
+
+  g := games[0]
+
+  if !reflect.DeepEqual(g.TagOrder, []string{"Event", "Site", "Result"}) {
+    t.Errorf("tag order %v", g.TagOrder)
+  }
+
+  if g.Tag("Event") != `Test "quoted"` || g.Tag("Site") != "Here" || g.Tag("Round") != "" {
+    t.Errorf("tags %v", g.Tags)
+  }
+
+  if g.Result != "1-0" || !reflect.DeepEqual(sans(g.Moves), []string{"e4", "e5"}) {
+    t.Errorf("result %s and moves %v", g.Result, sans(g.Moves))
+  }
+}
+
+func TestPGNSetUp(t *testing.T) {
+  fen := "8/4P3/8/8/8/8/k7/4K3 w - - 0 1"
+
+  g := readPGN(t, `[SetUp "1"]
+[FEN "` + fen + `"]
+
+1. e8=Q Kb2 *`)[0]
+
+  if start, err := g.StartingBoard(); err != nil || start.Fen() != fen {
+    t.Errorf("starting position %s, %v", start.Fen(), err)
+  }
+
+  if m := g.Moves[0]; MoveToAl([]int{m.From, m.To}) != "e7e8" || m.Promotion != "Q" {
+    t.Errorf("first move %+v", m)
+  }
+
+  if final, err := g.FinalBoard(); err != nil || final.Fen() != "4Q3/8/8/8/8/8/1k6/4K3 w - - 1 2" {
+    t.Errorf("final position %s, %v", final.Fen(), err)
+  }
+
+  // A FEN tag is ignored when SetUp says it is not used.
+  g = readPGN(t, `[SetUp "0"]
+[FEN "` + fen + `"]
+
+1. e4 *`)[0]
+
+  if start, _ := g.StartingBoard(); start.Fen() != startFen || len(g.Moves) != 1 {
+    t.Errorf("starting position %s and moves %v", start.Fen(), sans(g.Moves))
+  }
+}
+
+func TestPGNVariations(t *testing.T) {
+  g := readPGN(t, "1. e4 (1. d4 d5 (1... Nf6 2. c4)) e5 2. Nf3 *")[0]
+
+  if !reflect.DeepEqual(sans(g.Moves), []string{"e4", "e5", "Nf3"}) {
+    t.Fatalf("moves %v", sans(g.Moves))
+  }
+
+  // The variation is an alternative to 1. e4, and the nested one to 1... d5.
+  if len(g.Moves[0].Variations) != 1 {
+    t.Fatalf("variations %v", g.Moves[0].Variations)
+  }
+
+  variation := g.Moves[0].Variations[0]
+
+  if !reflect.DeepEqual(sans(variation), []string{"d4", "d5"}) || len(variation[1].Variations) != 1 ||
+     !reflect.DeepEqual(sans(variation[1].Variations[0]), []string{"Nf6", "c4"}) {
+    t.Errorf("variation %v", variation)
+  }
+
+  // A variation before the first move is an alternative to it.
+  g = readPGN(t, "(1. d4) 1. e4 e5 *")[0]
+
+  if len(g.Moves) != 2 || len(g.Moves[0].Variations) != 1 ||
+     !reflect.DeepEqual(sans(g.Moves[0].Variations[0]), []string{"d4"}) {
+    t.Errorf("moves %v, variations %v", sans(g.Moves), g.Moves[0].Variations)
+  }
+}
+
+func TestPGNAnnotations(t *testing.T) {
+  g := readPGN(t, `{Start} 1. e4 {best by test [%eval 0.25] [%clk 1:30:00]} e5 ; the rest of the line
+2. Nf3! $14 Nc6?! ({before} 2... d6) *`)[0]
+
+  if !reflect.DeepEqual(g.Comments, []string{"Start"}) {
+    t.Errorf("game comments %q", g.Comments)
+  }
+
+  e4, e5, nf3, nc6 := g.Moves[0], g.Moves[1], g.Moves[2], g.Moves[3]
+
+  if !reflect.DeepEqual(e4.Comments, []string{"best by test"}) || e4.Eval != "0.25" || e4.Clock != "1:30:00" {
+    t.Errorf("1. e4: %+v", e4)
+  }
+
+  if !reflect.DeepEqual(e5.Comments, []string{"the rest of the line"}) {
+    t.Errorf("1... e5: %+v", e5)
+  }
+
+  if !reflect.DeepEqual(nf3.NAGs, []int{1, 14}) || !reflect.DeepEqual(nc6.NAGs, []int{6}) {
+    t.Errorf("NAGs %v and %v", nf3.NAGs, nc6.NAGs)
+  }
+
+  if len(nc6.Variations) != 1 || !reflect.DeepEqual(nc6.Variations[0][0].PreComments, []string{"before"}) {
+    t.Errorf("2... Nc6: %+v", nc6)
+  }
+}
+
+func TestPGNResults(t *testing.T) {
+  var pgn string
+  results := []string{"1-0", "0-1", "1/2-1/2", "*"}
+
+  // Games without tags follow each other.
+  for _, result := range results {
+    pgn += "1. e4 e5 " + result + "\n\n"
+  }
+
+  games := readPGN(t, pgn)
+
+  if len(games) != len(results) {
+    t.Fatalf("%d games", len(games))
+  }
+
+  for i, g := range games {
+    if g.Result != results[i] || g.Tag("Result") != results[i] || len(g.Moves) != 2 {
+      t.Errorf("game %d: result %s, tag %s, moves %v", i + 1, g.Result, g.Tag("Result"), sans(g.Moves))
+    }
+  }
+}
+
+// An illegal move is reported with its location, and the game is read past
+// it so that the next one can be read.
+func TestPGNError(t *testing.T) {
+  pgn := `[Event "1"]
+
+1. e4 e5 *
+
+[Event "2"]
+
+1. e4 e5
+2. Ke3 Nc6 *
+
+[Event "3"]
+
+1. d4 *
+`
+
+  r := NewPGNReader(strings.NewReader(pgn))
+
+  if _, err := r.Next(); err != nil {
+    t.Fatal(err)
+  }
+
+  g, err := r.Next()
+
+  pgnErr, ok := err.(*PGNError)
+  if !ok {
+    t.Fatalf("error %v", err)
+  }
+
+  if pgnErr.Game != 2 || pgnErr.Line != 8 || pgnErr.Column != 4 || pgnErr.Ply != 3 || pgnErr.Move != "Ke3" {
+    t.Errorf("error %+v", pgnErr)
+  }
+
+  if g == nil || !reflect.DeepEqual(sans(g.Moves), []string{"e4", "e5"}) {
+    t.Errorf("game %+v", g)
+  }
+
+  if g, err := r.Next(); err != nil || g.Tag("Event") != "3" {
+    t.Errorf("next game %+v, %v", g, err)
+  }
+}
+
+func TestParseSAN(t *testing.T) {
+  cases := []struct {
+    fen string
+    san string
+    want string // The move in algebraic descriptive notation, "" for an error.
+  }{
+    // Disambiguation by file and by rank.
+    {"7k/8/8/8/8/8/8/KN3N2 w - - 0 1", "Nbd2", "b1d2"},
+    {"7k/8/8/8/8/8/8/KN3N2 w - - 0 1", "Nfd2", "f1d2"},
+    {"7k/8/8/8/8/8/8/KN3N2 w - - 0 1", "Nd2", ""},
+    {"7k/8/8/R7/8/8/8/R3K3 w - - 0 1", "R1a3", "a1a3"},
+    {"7k/8/8/R7/8/8/8/R3K3 w - - 0 1", "R5a3", "a5a3"},
+    {"7k/8/8/R7/8/8/8/R3K3 w - - 0 1", "Ra3", ""},
+
+    {"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", "exf6", "e5f6"},
+    {"rnbqkbnr/ppp1p1pp/8/3pPp2/8/8/PPPP1PPP/RNBQKBNR w KQkq f6 0 3", "exd6", ""},
+
+    // Promotions, with or without the =.
+    {"3r4/4P3/8/8/8/8/k7/4K3 w - - 0 1", "e8=Q", "e7e8q"},
+    {"3r4/4P3/8/8/8/8/k7/4K3 w - - 0 1", "e8=N", "e7e8n"},
+    {"3r4/4P3/8/8/8/8/k7/4K3 w - - 0 1", "e8R", "e7e8r"},
+    {"3r4/4P3/8/8/8/8/k7/4K3 w - - 0 1", "exd8=B", "e7d8b"},
+    {"8/8/8/8/8/4P3/k7/4K3 w - - 0 1", "e4=Q", ""},
+
+    {"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "O-O", "e1g1"},
+    {"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "O-O-O", "e1c1"},
+    {"r3k2r/8/8/8/8/8/8/R3K2R w KQkq - 0 1", "0-0", "e1g1"},
+    {"r3k2r/8/8/8/8/8/8/R3K2R b KQkq - 0 1", "O-O-O", "e8c8"},
+    {"r3k2r/8/8/8/8/8/8/R3K2R w - - 0 1", "O-O", ""},
+
+    // Check, mate and annotation suffixes.
+    {"k7/8/2K5/8/8/8/8/7R w - - 0 1", "Rh8+", "h1h8"},
+    {"rnbqkbnr/pppp1ppp/8/4p3/6P1/5P2/PPPPP2P/RNBQKBNR b KQkq g3 0 2", "Qh4#", "d8h4"},
+    {startFen, "e4!?", "e2e4"},
+
+    {startFen, "e5", ""},
+    {startFen, "Xe4", ""},
+  }
+
+  for _, tc := range cases {
+    board := boardFromFen(t, tc.fen)
+    from, to, promopiece, err := board.ParseSAN(tc.san)
+
+    if tc.want == "" {
+      if err == nil {
+        t.Errorf("%s: %s parsed as %s%s", tc.fen, tc.san, MoveToAl([]int{from, to}), promopiece)
+      }
+
+      continue
+    }
+
+    if err != nil {
+      t.Errorf("%s: %s: %v", tc.fen, tc.san, err)
+      continue
+    }
+
+    move := []int{from, to}
+    if promopiece != "" {
+      move = append(move, int(pieceVals[promopiece]))
+    }
+
+    if al := MoveToAl(move); al != tc.want {
+      t.Errorf("%s: %s parsed as %s, want %s", tc.fen, tc.san, al, tc.want)
+    }
+  }
+}
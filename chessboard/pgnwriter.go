@@ -0,0 +1,246 @@
+package chessboard
+
+// Serialises games to PGN export format, so that games played by the engine
+// can be reviewed in standard viewers.
+import (
+  "bufio"
+  "fmt"
+  "io"
+  "strconv"
+  "strings"
+  "time"
+)
+
+// Movetext lines are wrapped so that they never exceed this many characters.
+const pgnLineLength = 79
+
+// Creates a game from a list of moves in algebraic descriptive notation
+// (e.g. e2e4, e7e8q) played from the given FEN. The seven tag roster is filled
+// in with default values.
+func NewPGNGameFromMoves(fen string, moves []string) (*PGNGame, error) {
+  game := NewPGNGame()
+  board, err := NewChessboard(fen)
+
+  if err != nil {
+    return nil, err
+  }
+
+  game.SetTag("Event", "?")
+  game.SetTag("Site", "?")
+  game.SetTag("Date", time.Now().Format("2006.01.02"))
+  game.SetTag("Round", "-")
+  game.SetTag("White", "?")
+  game.SetTag("Black", "?")
+  game.SetTag("Result", "*")
+
+  if fen != startFen {
+    game.SetTag("SetUp", "1")
+    game.SetTag("FEN", fen)
+  }
+
+  for _, m := range moves {
+    if len(m) < 4 {
+      return game, fmt.Errorf("Invalid move %s.", m)
+    }
+
+    from, to := alToPos(m[0:2]), alToPos(m[2:4])
+    promopiece := strings.ToUpper(m[4:])
+    san := board.SAN(from, to, promopiece)
+
+    if !board.MakeMove(from, to, promopiece) {
+      return game, fmt.Errorf("Illegal move %s.", m)
+    }
+
+    game.Moves = append(game.Moves, &PGNMove{SAN: san, From: from, To: to, Promotion: promopiece})
+  }
+
+  game.Result = board.GameResult()
+  game.SetTag("Result", game.Result)
+
+  return game, nil
+}
+
+// Formats a centipawn score (from white's point of view) as an [%eval]
+// value in pawns, or #N for a mate in N moves (#-N when black mates).
+func FormatPGNEval(score int) string {
+  if n, ok := MateIn(score); ok {
+    return fmt.Sprintf("#%d", n)
+  }
+
+  sign := ""
+  if score < 0 {
+    sign = "-"
+    score = -score
+  }
+
+  return fmt.Sprintf("%s%d.%02d", sign, score / 100, score % 100)
+}
+
+// Writes the game in PGN export format: the seven tag roster followed by the
+// remaining tags, then the movetext wrapped to 79 columns.
+func (g *PGNGame) WritePGN(w io.Writer) error {
+  bw := bufio.NewWriter(w)
+
+  result := g.Result
+  if result == "" {
+    result = "*"
+  }
+
+  for _, name := range sevenTagRoster {
+    value, ok := g.Tags[name]
+
+    switch {
+    case name == "Result":
+      value = result
+    case !ok && name == "Date":
+      value = "????.??.??"
+    case !ok:
+      value = "?"
+    }
+
+    writePGNTag(bw, name, value)
+  }
+
+  for _, name := range g.TagOrder {
+    if indexOf(name, sevenTagRoster) != -1 {
+      continue
+    }
+
+    writePGNTag(bw, name, g.Tags[name])
+  }
+
+  bw.WriteString("\n")
+
+  board, err := g.StartingBoard()
+  if err != nil {
+    return err
+  }
+
+  words := make([]string, 0, 4 * len(g.Moves))
+
+  for _, c := range g.Comments {
+    words = append(words, commentWords(c)...)
+  }
+
+  words = appendMovetext(words, g.Moves, board.fullmoveNumber, board.turn)
+  words = append(words, result)
+
+  line := ""
+  for _, word := range words {
+    if line != "" && len(line) + 1 + len(word) > pgnLineLength {
+      bw.WriteString(line + "\n")
+      line = ""
+    }
+
+    if line != "" {
+      line += " "
+    }
+
+    line += word
+  }
+
+  bw.WriteString(line + "\n\n")
+
+  return bw.Flush()
+}
+
+// Writes a single tag pair, escaping quotes and backslashes in the value.
+func writePGNTag(w *bufio.Writer, name string, value string) {
+  value = strings.Replace(value, "\\", "\\\\", -1)
+  value = strings.Replace(value, "\"", "\\\"", -1)
+
+  fmt.Fprintf(w, "[%s \"%s\"]\n", name, value)
+}
+
+// Appends the words of the movetext of a line (and its variations) starting
+// at the given move number and side to move.
+func appendMovetext(words []string, moves []*PGNMove, number int, black bool) []string {
+  // Black's moves are only numbered at the start of a line, or after an
+  // interruption such as a comment or a variation.
+  numbered := true
+
+  for _, m := range moves {
+    for _, c := range m.PreComments {
+      words = append(words, commentWords(c)...)
+      numbered = true
+    }
+
+    // Move numbers are kept on the same line as the move they number.
+    if !black {
+      words = append(words, strconv.Itoa(number) + ". " + m.SAN)
+    } else if numbered {
+      words = append(words, strconv.Itoa(number) + "... " + m.SAN)
+    } else {
+      words = append(words, m.SAN)
+    }
+
+    numbered = false
+
+    for _, nag := range m.NAGs {
+      words = append(words, "$" + strconv.Itoa(nag))
+    }
+
+    comment := ""
+    if m.Eval != "" {
+      comment += "[%eval " + m.Eval + "] "
+    }
+
+    if m.Clock != "" {
+      comment += "[%clk " + m.Clock + "] "
+    }
+
+    comment += strings.Join(m.Comments, " ")
+
+    if comment = strings.TrimSpace(comment); comment != "" {
+      words = append(words, commentWords(comment)...)
+      numbered = true
+    }
+
+    for _, v := range m.Variations {
+      // An empty variation has nothing to write.
+      if len(v) == 0 {
+        continue
+      }
+
+      variation := appendMovetext(nil, v, number, black)
+      variation[0] = "(" + variation[0]
+      variation[len(variation) - 1] += ")"
+
+      words = append(words, variation...)
+      numbered = true
+    }
+
+    if black {
+      number += 1
+    }
+
+    black = !black
+  }
+
+  return words
+}
+
+// Splits a comment into words so that it can be wrapped across lines.
+func commentWords(comment string) []string {
+  words := strings.Fields(strings.Replace(comment, "}", "", -1))
+
+  if len(words) == 0 {
+    return []string{"{}"}
+  }
+
+  words[0] = "{" + words[0]
+  words[len(words) - 1] += "}"
+
+  return words
+}
+
+// Returns the index of s in list, or -1 if it is not present.
+func indexOf(s string, list []string) int {
+  for i, v := range list {
+    if v == s {
+      return i
+    }
+  }
+
+  return -1
+}
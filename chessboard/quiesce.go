@@ -0,0 +1,255 @@
+package chessboard
+
+import (
+  "sort"
+)
+
+// Values of the pieces used to order and prune captures, indexed by piece
+// value % 10. They match the base values of the evaluation.
+var pieceValues = [7]int{0, 100, 300, 330, 500, 900, 20000}
+
+// Searches captures and promotions (and optionally checks) until the
+// position is quiet, so that the evaluation is never taken in the middle of
+// an exchange. qply is the number of plies since the quiescence search
+// started.
+func (c *Chessboard) quiesce(a int, b int, ply int, qply int, s *searchState) int {
+  s.countNode()
+
+  if ply > s.seldepth {
+    s.seldepth = ply
+  }
+
+  if s.stopped() || ply >= maxPly {
+    return c.Evaluate()
+  }
+
+  alpha := a
+  beta := b
+
+  color := 0
+  if c.turn {
+    color = 1
+  }
+
+  inCheck := c.kingInCheck(color)
+  standPat := c.Evaluate()
+
+  var moves [][]int
+
+  if inCheck {
+    // The side to move cannot stand pat when in check, every evasion has
+    // to be searched.
+    moves = c.AllLegalMoves()
+
+    if len(moves) == 0 {
+      return c.noMovesScore(true, ply)
+    }
+  } else {
+    if standPat >= beta {
+      return beta
+    }
+
+    if standPat > alpha {
+      alpha = standPat
+    }
+
+    moves = c.tacticalMoves()
+
+    if s.params.QuiescenceChecks && qply == 0 {
+      moves = append(moves, c.quietChecks()...)
+    }
+  }
+
+  sort.SliceStable(moves, func(i, j int) bool {
+    return c.mvvLva(moves[i]) > c.mvvLva(moves[j])
+  })
+
+  for _, m := range(moves) {
+    if !inCheck && c.isTactical(m) {
+      // Delta pruning: even winning the captured piece for free would not
+      // bring the score back to alpha.
+      if standPat + c.captureGain(m) + s.params.DeltaMargin <= alpha {
+        continue
+      }
+
+      // Captures losing material are not worth searching.
+      if !c.attemptedPromotion(m[0], m[1]) && c.see(m[0], m[1]) < 0 {
+        continue
+      }
+    }
+
+    ok, restore := c.MakeMoveWithRestore(m[0], m[1], "")
+    if !ok {
+      continue
+    }
+
+    score := -c.quiesce(-beta, -alpha, ply + 1, qply + 1, s)
+    c.RestoreBoard(restore)
+
+    if s.stopped() {
+      return alpha
+    }
+
+    if score >= beta {
+      return beta
+    }
+
+    if score > alpha {
+      alpha = score
+    }
+  }
+
+  return alpha
+}
+
+// Returns the captures (including en passant) and promotions of the side to
+// move. The moves may leave the king in check.
+func (c Chessboard) tacticalMoves() [][]int {
+  moves := make([][]int, 0, 16)
+
+  color := 0
+  if c.turn {
+    color = 1
+  }
+
+  for from := 0; from < 64; from++ {
+    if !c.validColorPiece(from, color) {
+      continue
+    }
+
+    for _, to := range c.candSquares(from) {
+      if c.isTactical([]int{from, to}) && c.prelimValidMove(from, to) {
+        moves = append(moves, []int{from, to})
+      }
+    }
+  }
+
+  return moves
+}
+
+// Returns the legal moves which are not captures or promotions, but give
+// check.
+func (c Chessboard) quietChecks() [][]int {
+  checks := make([][]int, 0, 8)
+  b := c.Copy()
+
+  color := 0
+  if c.turn {
+    color = 1
+  }
+
+  for _, m := range b.AllLegalMoves() {
+    if b.isTactical(m) {
+      continue
+    }
+
+    _, restore := b.MakeMoveWithRestore(m[0], m[1], "")
+
+    if b.kingInCheck(1 - color) {
+      checks = append(checks, m)
+    }
+
+    b.RestoreBoard(restore)
+  }
+
+  return checks
+}
+
+// Returns true if the move is a capture or a promotion.
+func (c Chessboard) isTactical(m []int) bool {
+  if c.validColorPiece(m[1], 1 - c.pieceColorOnPosition(m[0])) {
+    return true
+  }
+
+  return c.validPiecePawn(m[0]) && (m[1] == c.enpassantPos || c.attemptedPromotion(m[0], m[1]))
+}
+
+// Returns the material won by a move, ignoring recaptures: the value of the
+// captured piece, plus the value gained by a promotion.
+func (c Chessboard) captureGain(m []int) int {
+  gain := 0
+
+  if c.validPiece(m[1]) {
+    gain = pieceValues[c.boardSquares[m[1]] % 10]
+  } else if c.validPiecePawn(m[0]) && m[1] == c.enpassantPos {
+    gain = pieceValues[1]
+  }
+
+  if c.attemptedPromotion(m[0], m[1]) {
+    gain += pieceValues[5] - pieceValues[1]
+  }
+
+  return gain
+}
+
+// Orders captures by most valuable victim first, then least valuable
+// attacker. Promotions count as capturing a queen, and quiet moves come
+// last.
+func (c Chessboard) mvvLva(m []int) int {
+  victim := 0
+
+  if c.validPiece(m[1]) {
+    victim = int(c.boardSquares[m[1]] % 10)
+  } else if c.validPiecePawn(m[0]) && m[1] == c.enpassantPos {
+    victim = 1
+  }
+
+  if c.attemptedPromotion(m[0], m[1]) {
+    victim += 5
+  }
+
+  if victim == 0 {
+    return 0
+  }
+
+  return 10 * victim - int(c.boardSquares[m[0]] % 10)
+}
+
+// Returns the static exchange evaluation of the capture from -> to: the
+// material won (or lost, if negative) when both sides keep recapturing on
+// the square with their least valuable piece for as long as it pays off.
+// Pins are ignored.
+func (c Chessboard) see(from int, to int) int {
+  b := c.Copy()
+  gain := make([]int, 1, 32)
+  gain[0] = c.captureGain([]int{from, to})
+
+  if c.validPiecePawn(from) && to == c.enpassantPos && !c.validPiece(to) {
+    b.boardSquares[posFromRowColumn(rowFromPosition(from), colFromPosition(to))] = -1
+  }
+
+  attacker := from
+  side := c.pieceColorOnPosition(from)
+
+  for {
+    piece := b.boardSquares[attacker]
+    b.boardSquares[to] = piece
+    b.boardSquares[attacker] = -1
+    side = 1 - side
+
+    // Pieces behind the one which has just captured are found as soon as
+    // it leaves its square.
+    next := -1
+    for _, p := range b.piecesThreateningPos(to, 1 - side) {
+      if next == -1 || pieceValues[b.boardSquares[p] % 10] < pieceValues[b.boardSquares[next] % 10] {
+        next = p
+      }
+    }
+
+    if next == -1 {
+      break
+    }
+
+    gain = append(gain, pieceValues[piece % 10] - gain[len(gain) - 1])
+    attacker = next
+  }
+
+  // Either side can stop recapturing when it would lose material.
+  for d := len(gain) - 1; d > 0; d-- {
+    if gain[d] > -gain[d - 1] {
+      gain[d - 1] = -gain[d]
+    }
+  }
+
+  return gain[0]
+}
@@ -0,0 +1,36 @@
+package chessboard
+
+import (
+  "testing"
+)
+
+func TestSEE(t *testing.T) {
+  cases := []struct {
+    name string
+    fen string
+    move string
+    want int
+  }{
+    {"hanging knight", "4k3/8/8/3n4/8/8/8/3RK3 w - - 0 1", "d1d5", 300},
+    {"defended pawn", "4k3/8/4p3/3p4/8/8/8/3QK3 w - - 0 1", "d1d5", 100 - 900},
+    {"defended pawn by black", "4k3/8/8/6b1/8/4P3/3P4/4K3 b - - 0 1", "g5e3", 100 - 330},
+
+    // The rook behind the one which captures first recaptures in turn.
+    {"single rook", "3rk3/8/8/3p4/8/8/3R4/4K3 w - - 0 1", "d2d5", 100 - 500},
+    {"x-ray", "3rk3/8/8/3p4/8/8/3R4/3RK3 w - - 0 1", "d2d5", 100},
+
+    {"en passant", "4k3/8/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", 100},
+    {"defended en passant", "4k3/2p5/8/3pP3/8/8/8/4K3 w - d6 0 1", "e5d6", 0},
+
+    // The pawn taken en passant leaves the file open to the rook.
+    {"en passant x-ray", "4k3/2p5/8/3pP3/8/8/8/3RK3 w - d6 0 1", "e5d6", 100},
+  }
+
+  for _, tc := range cases {
+    board := boardFromFen(t, tc.fen)
+
+    if see := board.see(alToPos(tc.move[:2]), alToPos(tc.move[2:])); see != tc.want {
+      t.Errorf("%s: %s is worth %d, want %d", tc.name, tc.move, see, tc.want)
+    }
+  }
+}
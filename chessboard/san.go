@@ -0,0 +1,208 @@
+package chessboard
+
+import (
+  "errors"
+  "regexp"
+  "strings"
+)
+
+// Matches a standard algebraic move (without castling), capturing the piece,
+// the disambiguating file and rank, the destination and the promotion piece.
+var sanPattern = regexp.MustCompile("^([KQRBN])?([a-h])?([1-8])?x?([a-h][1-8])(?:=?([QRBNqrbn]))?$")
+
+// Piece letters used by SAN, indexed by piece value % 10.
+var sanPieceLetters = map[string]int{
+  "K": 6,
+  "Q": 5,
+  "R": 4,
+  "B": 3,
+  "N": 2,
+}
+
+// Parses a move in standard algebraic notation (e.g. Nbd7, exd5, O-O,
+// e8=Q+) against the current position. Returns the from and to squares along
+// with the promotion piece, or an error if the move is illegal or ambiguous.
+func (c Chessboard) ParseSAN(san string) (from int, to int, promopiece string, err error) {
+  move := strings.TrimRight(san, "+#!?")
+  color := 0
+
+  if c.turn {
+    color = 1
+  }
+
+  kingPos := c.kingCastlePosition(color)
+
+  switch move {
+  case "O-O", "0-0":
+    from, to = kingPos, kingPos + 2
+  case "O-O-O", "0-0-0":
+    from, to = kingPos, kingPos - 2
+  }
+
+  if from != to {
+    if !c.validPieceKing(from) || !c.moveIsLegal(from, to, "") {
+      err = errors.New("Illegal castling move " + san + ".")
+    }
+
+    return
+  }
+
+  parts := sanPattern.FindStringSubmatch(move)
+
+  if parts == nil {
+    err = errors.New("Invalid move " + san + ".")
+    return
+  }
+
+  piece := 1
+  if parts[1] != "" {
+    piece = sanPieceLetters[parts[1]]
+  }
+
+  fromCol, fromRow := -1, -1
+  if parts[2] != "" {
+    fromCol = int(parts[2][0] - 'a')
+  }
+
+  if parts[3] != "" {
+    fromRow = 8 - int(parts[3][0] - '0')
+  }
+
+  to = alToPos(parts[4])
+  promopiece = strings.ToUpper(parts[5])
+  from = -1
+
+  for i := 0; i < 64; i++ {
+    if !c.validColorPiece(i, color) || int(c.boardSquares[i] % 10) != piece {
+      continue
+    }
+
+    if (fromCol != -1 && colFromPosition(i) != fromCol) ||
+       (fromRow != -1 && rowFromPosition(i) != fromRow) {
+      continue
+    }
+
+    if !intInSlice(to, c.candSquares(i)) || !c.moveIsLegal(i, to, "") {
+      continue
+    }
+
+    if from != -1 {
+      err = errors.New("Ambiguous move " + san + ".")
+      return
+    }
+
+    from = i
+  }
+
+  if from == -1 {
+    err = errors.New("Illegal move " + san + ".")
+    return
+  }
+
+  if promopiece != "" && !c.attemptedPromotion(from, to) {
+    err = errors.New("Invalid promotion " + san + ".")
+  }
+
+  return
+}
+
+// Makes a move given in standard algebraic notation, returning an error if
+// the move could not be played.
+func (c *Chessboard) MoveSAN(san string) error {
+  from, to, promopiece, err := c.ParseSAN(san)
+
+  if err != nil {
+    return err
+  }
+
+  if !c.MakeMove(from, to, promopiece) {
+    return errors.New("Illegal move " + san + ".")
+  }
+
+  return nil
+}
+
+// Returns the standard algebraic notation of the move from -> to in the
+// current position, including check and checkmate suffixes. The move is
+// assumed to be legal.
+func (c Chessboard) SAN(from int, to int, promopiece string) string {
+  color := c.pieceColorOnPosition(from)
+  piece := int(c.boardSquares[from] % 10)
+  san := ""
+
+  if c.castlingAttempt(color, from, to) && c.validPieceKing(from) {
+    san = "O-O"
+
+    if c.queensideCastlingAttempt(color, from, to) {
+      san = "O-O-O"
+    }
+  } else {
+    capture := c.validPiece(to) || (piece == 1 && c.enpassantPos == to)
+
+    if piece == 1 {
+      if capture {
+        san = PosToAl(from)[0:1]
+      }
+    } else {
+      for k, v := range sanPieceLetters {
+        if v == piece {
+          san = k
+        }
+      }
+
+      // Disambiguate between pieces of the same kind reaching the same square.
+      sameFile, sameRank, ambiguous := false, false, false
+
+      for i := 0; i < 64; i++ {
+        if i == from || c.boardSquares[i] != c.boardSquares[from] {
+          continue
+        }
+
+        if !intInSlice(to, c.candSquares(i)) || !c.moveIsLegal(i, to, "") {
+          continue
+        }
+
+        ambiguous = true
+        sameFile = sameFile || colFromPosition(i) == colFromPosition(from)
+        sameRank = sameRank || rowFromPosition(i) == rowFromPosition(from)
+      }
+
+      if ambiguous {
+        if !sameFile {
+          san += PosToAl(from)[0:1]
+        } else if !sameRank {
+          san += PosToAl(from)[1:2]
+        } else {
+          san += PosToAl(from)
+        }
+      }
+    }
+
+    if capture {
+      san += "x"
+    }
+
+    san += PosToAl(to)
+
+    if c.attemptedPromotion(from, to) {
+      if promopiece == "" {
+        promopiece = "Q"
+      }
+
+      san += "=" + strings.ToUpper(promopiece)
+    }
+  }
+
+  after := c.Copy()
+  after.MakeMove(from, to, promopiece)
+
+  if after.kingInCheck(1 - color) {
+    if len(after.AllLegalMoves()) == 0 {
+      san += "#"
+    } else {
+      san += "+"
+    }
+  }
+
+  return san
+}
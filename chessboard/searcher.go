@@ -0,0 +1,329 @@
+package chessboard
+
+import (
+  "context"
+  "fmt"
+  "strings"
+  "sync"
+  "time"
+)
+
+// The progress of a search, reported after every iteration and whenever the
+// score of an iteration falls outside of its aspiration window.
+type Info struct {
+  Depth int
+  SelDepth int // The deepest ply reached by the iteration.
+  Nodes int // The nodes searched so far by all the threads.
+  NPS int
+  Score int // From the side to move's point of view, see MateIn for mate scores.
+  Bound string // "lowerbound" or "upperbound" when Score is only a bound, empty when it is exact.
+  Time time.Duration // The time since the search started.
+  HashFull int // The permille of the transposition table in use.
+  MultiPV int // The line the info is about, from 1.
+  PV [][]int // The line, empty when Score is only a bound.
+}
+
+// Formats the info as a UCI info line.
+func (i Info) String() string {
+  line := fmt.Sprintf("info depth %d seldepth %d nodes %d nps %d score %s",
+                      i.Depth, i.SelDepth, i.Nodes, i.NPS, uciScore(i.Score))
+
+  if i.Bound != "" {
+    line += " " + i.Bound
+  }
+
+  line += fmt.Sprintf(" time %d hashfull %d multipv %d", i.Time.Milliseconds(), i.HashFull, i.MultiPV)
+
+  if len(i.PV) > 0 {
+    moves := make([]string, len(i.PV))
+
+    for j, m := range i.PV {
+      moves[j] = MoveToAl(m)
+    }
+
+    line += " pv " + strings.Join(moves, " ")
+  }
+
+  return line
+}
+
+// Receives the progress of a search. It is called from the goroutine running
+// the search, which waits for it to return.
+type InfoHandler func(Info)
+
+// An InfoHandler printing UCI info lines to the standard output.
+func PrintInfo(i Info) {
+  fmt.Println(i)
+}
+
+// The outcome of a search.
+type Result struct {
+  Move []int // The best move, nil when the position is mate or stalemate.
+  PV [][]int // The best line, starting with Move.
+  Score int // From the side to move's point of view, 0 for book moves.
+  Depth int // The depth of the iteration which found the line.
+  Book bool // Set when the move comes from the opening books, without searching.
+  Stats SearchStats
+}
+
+// Searches positions: the entry point of the search for programs embedding
+// the engine. A Searcher runs searches on a copy of the board it is given,
+// reports their progress to a callback, and can be cancelled through a
+// context from any goroutine.
+//
+// The zero value searches with a single thread, with the transposition table
+// (see SetHashSize) and the parameters of the package, and does not report
+// its progress. Searches sharing a table can run at the same time, but they
+// then replace each other's entries. A Searcher made by NewSearcher has a
+// table of its own.
+//
+// The move ordering tables of the threads are kept and aged from one search
+// to the next, so a Searcher should not be copied once it has searched.
+type Searcher struct {
+  Threads int // The number of threads searching, 1 if 0.
+  Info InfoHandler // Receives the progress of the search, nil to ignore it.
+  Params *SearchParams // The parameters of the search, nil for those set with SetSearchParams.
+
+  tt *transpositionTable // nil for the table of the package.
+
+  // The move ordering tables of the threads, kept from one search to the
+  // next.
+  mu sync.Mutex
+  histories []*moveHistory
+}
+
+// Creates a searcher with a transposition table of its own, of (about) the
+// given number of megabytes.
+func NewSearcher(mb int) *Searcher {
+  return &Searcher{tt: newTranspositionTable(mb)}
+}
+
+// Returns the transposition table of the searcher.
+func (sr *Searcher) table() *transpositionTable {
+  if sr.tt != nil {
+    return sr.tt
+  }
+
+  return packageTable()
+}
+
+// Empties the transposition table of the searcher, which is the table of
+// the package for searchers not made by NewSearcher, and forgets the move
+// ordering tables kept from the previous searches.
+func (sr *Searcher) ClearHash() {
+  sr.table().clear()
+
+  sr.mu.Lock()
+  sr.histories = nil
+  sr.mu.Unlock()
+}
+
+// Returns the move ordering tables of n threads: the tables kept from the
+// previous searches, and new ones for the threads which have none. A search
+// running at the same time as another search of the searcher gets new
+// tables.
+func (sr *Searcher) takeHistories(n int) []*moveHistory {
+  sr.mu.Lock()
+  defer sr.mu.Unlock()
+
+  histories := make([]*moveHistory, n)
+  kept := copy(histories, sr.histories)
+  sr.histories = sr.histories[kept:]
+
+  for i := kept; i < n; i++ {
+    histories[i] = new(moveHistory)
+  }
+
+  return histories
+}
+
+// Keeps the move ordering tables of a search for the next one, as many as
+// there are threads.
+func (sr *Searcher) putHistories(histories []*moveHistory) {
+  sr.mu.Lock()
+  defer sr.mu.Unlock()
+
+  threads := sr.Threads
+  if threads < 1 {
+    threads = 1
+  }
+
+  sr.histories = append(histories, sr.histories...)
+  if len(sr.histories) > threads {
+    sr.histories = sr.histories[:threads]
+  }
+}
+
+// Searches the position until one of the limits is reached or the context
+// is done, and returns the best line found. Book moves are returned
+// straight away, without searching. A legal move is returned even when the
+// search is stopped before its first iteration completes, and no move only
+// when the position is mate or stalemate.
+//
+// The search deepens iteratively. From the second iteration on, it starts
+// with an aspiration window around the score of the previous iteration
+// (see aspirationSearch).
+//
+// With MultiPV, each iteration searches the root once per line, and the
+// lines are reported best first. The move returned is the first move of the
+// best line. With more than one thread, the helper threads only search for
+// the best line (see smp.go).
+//
+// A single threaded search with a node limit is deterministic for a given
+// transposition table, as long as it is not timed.
+//
+// A mate search does not prune or reduce moves, so that a mate in N moves
+// is always found by the iteration of depth 2N - 1, where the search ends.
+func (sr *Searcher) Search(ctx context.Context, c Chessboard, limits SearchLimits) Result {
+  rootMoves := c.legalRootMoves(limits.SearchMoves)
+
+  if cm := c.bookMove(); len(cm) >= 2 && (rootMoves == nil || containsMove(rootMoves, cm)) {
+    return Result{Move: cm, PV: [][]int{cm}, Book: true}
+  }
+
+  depth := maxPly - 1
+  if limits.Depth > 0 && limits.Depth < depth {
+    depth = limits.Depth
+  }
+
+  if limits.Mate > 0 && 2 * limits.Mate - 1 < depth {
+    depth = 2 * limits.Mate - 1
+  }
+
+  params := CurrentSearchParams()
+  if sr.Params != nil {
+    params = *sr.Params
+  }
+
+  shared := &searchShared{tt: sr.table(), params: params, start: time.Now(), limits: limits,
+                          rootMoves: rootMoves, rootHash: c.BookHash(), rootTurn: c.turn, report: sr.Info}
+  shared.tt.newSearch()
+
+  legal := make([]uint16, 0, 32)
+  for _, m := range c.AllLegalMoves() {
+    legal = append(legal, packMove(m))
+  }
+
+  // Mate and stalemate end the game, there is nothing to search.
+  if len(legal) == 0 {
+    color := 0
+    if c.turn {
+      color = 1
+    }
+
+    score := c.noMovesScore(c.kingInCheck(color), 0)
+    (&searchState{searchShared: shared}).info(0, 1, score, "", nil)
+
+    return Result{Score: score}
+  }
+
+  if rootMoves != nil {
+    legal = rootMoves
+  }
+
+  // Not more lines can be searched than there are root moves.
+  multiPV := limits.MultiPV
+  if multiPV < 1 {
+    multiPV = 1
+  }
+
+  if multiPV > len(legal) {
+    multiPV = len(legal)
+  }
+
+  threads := make([]*searchState, 1)
+  if sr.Threads > 1 {
+    threads = make([]*searchState, sr.Threads)
+  }
+
+  histories := sr.takeHistories(len(threads))
+  defer sr.putHistories(histories)
+
+  for i := range threads {
+    threads[i] = &searchState{searchShared: shared, id: i, history: histories[i]}
+  }
+
+  // The context is watched by its own goroutine, so that the threads only
+  // have to look at the stop flag.
+  done := make(chan struct{})
+  defer close(done)
+
+  go func() {
+    select {
+    case <-ctx.Done():
+      shared.setStop()
+    case <-done:
+    }
+  }()
+
+  // The helper threads search copies of the board, only looking for the
+  // best line, until the main thread is done.
+  var wg sync.WaitGroup
+
+  for _, t := range threads[1:] {
+    wg.Add(1)
+
+    go func(board Chessboard, t *searchState) {
+      defer wg.Done()
+      t.history.age()
+      board.iterativeDeepening(depth, 1, t)
+    }(c.Copy(), t)
+  }
+
+  main := threads[0]
+  main.history.age()
+  c.iterativeDeepening(depth, multiPV, main)
+
+  main.setStop()
+  wg.Wait()
+
+  best := main
+  if multiPV == 1 {
+    best = bestThread(threads)
+
+    if best != main {
+      main.info(best.completedDepth, 1, best.lines[0].score, "", best.lines[0].moves)
+    }
+  }
+
+  result := Result{Stats: SearchStats{Nodes: int(shared.totalNodes)}}
+  for _, t := range threads {
+    result.Stats.Cutoffs += t.cutoffs
+    result.Stats.FirstMoveCutoffs += t.firstMoveCutoffs
+  }
+
+  if len(best.lines) > 0 {
+    result.PV = best.lines[0].moves
+    result.Move = result.PV[0]
+    result.Score = best.lines[0].score
+    result.Depth = best.completedDepth
+  } else {
+    result.Move = c.withPromotion(main.fallbackMove(legal))
+    result.PV = [][]int{result.Move}
+  }
+
+  return result
+}
+
+// Returns a move for a search stopped before its first iteration completed:
+// the best root move found so far, or else the move of the transposition
+// table, or else the first of the legal root moves.
+func (s *searchState) fallbackMove(legal []uint16) []int {
+  var candidates []uint16
+
+  if s.pvLength[0] > 0 {
+    candidates = append(candidates, s.pvTable[0][0])
+  }
+
+  if e, ok := s.tt.probe(s.rootHash); ok {
+    candidates = append(candidates, packMove(e.move()))
+  }
+
+  for _, packed := range candidates {
+    if m := unpackMove(packed); m != nil && containsMove(legal, m) {
+      return m
+    }
+  }
+
+  return unpackMove(legal[0])
+}
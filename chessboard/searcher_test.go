@@ -0,0 +1,351 @@
+package chessboard
+
+import (
+  "context"
+  "testing"
+)
+
+// Searches a position with a single thread, from an empty transposition
+// table.
+func searchFen(t *testing.T, fen string, limits SearchLimits) Result {
+  board, err := NewChessboard(fen)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  ClearHash()
+
+  searcher := &Searcher{Threads: 1}
+  return searcher.Search(context.Background(), board, limits)
+}
+
+// A single threaded search with a node limit always searches the same tree,
+// which the bench command relies on.
+func TestSearchNodesDeterministic(t *testing.T) {
+  fen := "r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4"
+  limits := SearchLimits{Nodes: 5000}
+
+  first := searchFen(t, fen, limits)
+  second := searchFen(t, fen, limits)
+
+  if first.Stats.Nodes != second.Stats.Nodes {
+    t.Errorf("nodes %d and %d", first.Stats.Nodes, second.Stats.Nodes)
+  }
+
+  if MoveToAl(first.Move) != MoveToAl(second.Move) {
+    t.Errorf("moves %s and %s", MoveToAl(first.Move), MoveToAl(second.Move))
+  }
+
+  if len(first.PV) != len(second.PV) {
+    t.Fatalf("lines %v and %v", first.PV, second.PV)
+  }
+
+  for i := range first.PV {
+    if MoveToAl(first.PV[i]) != MoveToAl(second.PV[i]) {
+      t.Fatalf("lines %v and %v", first.PV, second.PV)
+    }
+  }
+}
+
+func TestSearchMate(t *testing.T) {
+  // 1. Kb6 Kb8 2. Rh8#, or 1. Kc7 Ka7 2. Ra1#
+  result := searchFen(t, "k7/8/2K5/8/8/8/8/7R w - - 0 1", SearchLimits{Mate: 2})
+
+  if n, ok := MateIn(result.Score); !ok || n != 2 {
+    t.Errorf("score %d, want a mate in 2", result.Score)
+  }
+}
+
+// There is nothing to search when the side to move is mated or stalemated,
+// and no move is returned.
+func TestSearchNoMoves(t *testing.T) {
+  // Fool's mate.
+  mated := searchFen(t, "rnb1kbnr/pppp1ppp/8/4p3/6Pq/5P2/PPPPP2P/RNBQKBNR w KQkq - 1 3", SearchLimits{Depth: 4})
+
+  if mated.Move != nil {
+    t.Errorf("mated: move %s", MoveToAl(mated.Move))
+  }
+
+  if n, ok := MateIn(mated.Score); !ok || n != 0 {
+    t.Errorf("mated: score %d, want mate 0", mated.Score)
+  }
+
+  stalemated := searchFen(t, "7k/5Q2/6K1/8/8/8/8/8 b - - 0 1", SearchLimits{Depth: 4})
+
+  if stalemated.Move != nil {
+    t.Errorf("stalemated: move %s", MoveToAl(stalemated.Move))
+  }
+
+  if stalemated.Score != 0 {
+    t.Errorf("stalemated: score %d, want 0", stalemated.Score)
+  }
+}
+
+// A search stopped before its first iteration completes still returns a
+// legal move.
+func TestSearchStoppedEarly(t *testing.T) {
+  fen := "r3k2r/p1ppqpb1/bn2pnp1/3PN3/1p2P3/2N2Q1p/PPPBBPPP/R3K2R w KQkq - 0 1"
+
+  board, err := NewChessboard(fen)
+  if err != nil {
+    t.Fatal(err)
+  }
+
+  var legal []uint16
+  for _, m := range board.AllLegalMoves() {
+    legal = append(legal, packMove(m))
+  }
+
+  result := searchFen(t, fen, SearchLimits{Nodes: 1})
+
+  if result.Depth != 0 {
+    t.Fatalf("the search completed depth %d", result.Depth)
+  }
+
+  if result.Move == nil || !containsMove(legal, result.Move) {
+    t.Errorf("move %v is not legal", result.Move)
+  }
+}
+
+// The line returned can be played from the position searched, and names
+// the piece of its promotions.
+func TestSearchPV(t *testing.T) {
+  fens := []string{
+    "r1bqkb1r/pppp1ppp/2n2n2/4p3/2B1P3/5N2/PPPP1PPP/RNBQK2R w KQkq - 4 4",
+    "8/P7/8/8/8/8/8/k6K w - - 0 1",
+  }
+
+  for _, fen := range fens {
+    board, err := NewChessboard(fen)
+    if err != nil {
+      t.Fatal(err)
+    }
+
+    result := searchFen(t, fen, SearchLimits{Depth: 4})
+
+    if len(result.PV) == 0 || MoveToAl(result.PV[0]) != MoveToAl(result.Move) {
+      t.Fatalf("%s: line %v does not start with %v", fen, result.PV, result.Move)
+    }
+
+    b := board.Copy()
+
+    for _, m := range result.PV {
+      if b.attemptedPromotion(m[0], m[1]) && len(m) < 3 {
+        t.Errorf("%s: promotion %s has no piece", fen, MoveToAl(m))
+      }
+
+      if legal, _ := b.MakeMoveWithRestore(m[0], m[1], ""); !legal {
+        t.Fatalf("%s: illegal move %s in line %v", fen, MoveToAl(m), result.PV)
+      }
+    }
+  }
+}
+
+// The move ordering tables of the threads are kept from one search to the
+// next, as many as there are threads.
+func TestSearcherKeepsHistories(t *testing.T) {
+  board := boardFromFen(t, startFen)
+  limits := SearchLimits{Depth: 3}
+
+  sr := NewSearcher(1)
+  sr.Threads = 2
+  sr.Search(context.Background(), board, limits)
+
+  if len(sr.histories) != 2 {
+    t.Fatalf("%d tables kept, want 2", len(sr.histories))
+  }
+
+  kept := append([]*moveHistory(nil), sr.histories...)
+  sr.Search(context.Background(), board, limits)
+
+  if len(sr.histories) != 2 || sr.histories[0] != kept[0] || sr.histories[1] != kept[1] {
+    t.Errorf("the tables were not reused")
+  }
+
+  sr.Threads = 1
+  sr.Search(context.Background(), board, limits)
+
+  if len(sr.histories) != 1 || sr.histories[0] != kept[0] {
+    t.Errorf("%d tables kept for 1 thread", len(sr.histories))
+  }
+
+  sr.ClearHash()
+
+  if len(sr.histories) != 0 {
+    t.Errorf("%d tables kept after ClearHash", len(sr.histories))
+  }
+}
+
+// Searches a position with a single thread and the given contempt, from an
+// empty transposition table.
+func searchContempt(t *testing.T, fen string, contempt int, limits SearchLimits) Result {
+  params := DefaultSearchParams()
+  params.Contempt = contempt
+
+  ClearHash()
+
+  searcher := &Searcher{Threads: 1, Params: &params}
+  return searcher.Search(context.Background(), boardFromFen(t, fen), limits)
+}
+
+// Returns true if the score is a draw score for the given contempt, which
+// varies by a centipawn.
+func isDrawScore(score int, contempt int) bool {
+  return score >= -contempt - 1 && score <= -contempt + 1
+}
+
+// A draw is worth -Contempt to the side the engine plays, and +Contempt to
+// its opponent.
+func TestDrawScore(t *testing.T) {
+  params := DefaultSearchParams()
+  params.Contempt = 30
+
+  for _, rootTurn := range []bool{false, true} {
+    s := &searchState{searchShared: &searchShared{params: params, rootTurn: rootTurn}}
+
+    for _, fen := range []string{startFen, "rnbqkbnr/pppppppp/8/8/4P3/8/PPPP1PPP/RNBQKBNR b KQkq e3 0 1"} {
+      board := boardFromFen(t, fen)
+
+      want := -30
+      if board.turn != rootTurn {
+        want = 30
+      }
+
+      for nodes := 0; nodes < 4; nodes++ {
+        s.nodes = nodes
+
+        if score := s.drawScore(&board); score < want - 1 || score > want + 1 {
+          t.Errorf("%s with root turn %v: draw score %d, want %d", fen, rootTurn, score, want)
+        }
+      }
+    }
+  }
+}
+
+// A position repeated in the line searched is a draw.
+func TestRepetition(t *testing.T) {
+  board := boardFromFen(t, startFen)
+  s := &searchState{searchShared: &searchShared{}}
+
+  var prevMoves [][]int
+  s.keys[0] = board.BookHash()
+
+  for ply, al := range []string{"g1f3", "g8f6", "f3g1", "f6g8"} {
+    m := []int{alToPos(al[:2]), alToPos(al[2:])}
+    board.MakeMove(m[0], m[1], "")
+    prevMoves = append(prevMoves, m)
+    s.keys[ply + 1] = board.BookHash()
+
+    if draw := s.isDraw(&board, ply + 1, prevMoves); draw != (ply == 3) {
+      t.Errorf("after %s: draw %v", al, draw)
+    }
+  }
+
+  // A null move in between breaks the repetition.
+  prevMoves[1] = nil
+
+  if s.isDraw(&board, 4, prevMoves) {
+    t.Errorf("repetition across a null move")
+  }
+}
+
+// The side which is lost forces a repetition by perpetual check, and the
+// side which is winning cannot avoid it. Either way the draw is scored for
+// the side the engine plays.
+func TestSearchPerpetualCheck(t *testing.T) {
+  fen := "4Q3/6pk/8/8/8/1q6/r7/7K w - - 0 1"
+  checked := "8/6pk/8/7Q/8/1q6/r7/7K b - - 1 1"
+
+  for _, contempt := range []int{0, 30, -30} {
+    for _, f := range []string{fen, checked} {
+      result := searchContempt(t, f, contempt, SearchLimits{Depth: 6})
+
+      if !isDrawScore(result.Score, contempt) {
+        t.Errorf("%s with contempt %d: score %d", f, contempt, result.Score)
+      }
+    }
+  }
+}
+
+// Every move reaches the hundredth half move without a capture or a pawn
+// move, which draws even a queen up.
+func TestSearchFiftyMoves(t *testing.T) {
+  result := searchContempt(t, "8/8/8/4k3/8/8/8/KQ6 w - - 99 80", 20, SearchLimits{Depth: 4})
+
+  if !isDrawScore(result.Score, 20) {
+    t.Errorf("score %d, want a draw", result.Score)
+  }
+
+  result = searchContempt(t, "8/8/8/4k3/8/8/8/KQ6 w - - 0 80", 20, SearchLimits{Depth: 4})
+
+  if result.Score < 500 {
+    t.Errorf("score %d without the fifty-move rule", result.Score)
+  }
+}
+
+// The knight takes the queen, unless the search is restricted to other moves.
+const queenUp = "rnb1kbnr/pppp1ppp/8/4p1q1/4P3/5N2/PPPP1PPP/RNBQKB1R w KQkq - 2 3"
+
+func TestSearchMoves(t *testing.T) {
+  if result := searchFen(t, queenUp, SearchLimits{Depth: 4}); MoveToAl(result.Move) != "f3g5" {
+    t.Fatalf("move %s, want f3g5", MoveToAl(result.Move))
+  }
+
+  searchMoves := []string{"a2a3", "h2h3"}
+
+  for _, limits := range []SearchLimits{
+    {Depth: 4, SearchMoves: searchMoves},
+    {Nodes: 1, SearchMoves: searchMoves},
+    {Depth: 4, SearchMoves: searchMoves, MultiPV: 3},
+  } {
+    result := searchFen(t, queenUp, limits)
+
+    if al := MoveToAl(result.Move); al != "a2a3" && al != "h2h3" {
+      t.Errorf("%+v: move %s", limits, al)
+    }
+
+    if len(result.PV) == 0 || MoveToAl(result.PV[0]) != MoveToAl(result.Move) {
+      t.Errorf("%+v: line %v", limits, result.PV)
+    }
+  }
+}
+
+// Every line of a MultiPV search starts with a different move, and the lines
+// are reported best first.
+func TestSearchMultiPV(t *testing.T) {
+  lines := make(map[int]Info)
+
+  searcher := &Searcher{Threads: 1, Info: func(i Info) {
+    if i.Bound == "" && len(i.PV) > 0 {
+      lines[i.MultiPV] = i
+    }
+  }}
+
+  ClearHash()
+  result := searcher.Search(context.Background(), boardFromFen(t, queenUp), SearchLimits{Depth: 4, MultiPV: 3})
+
+  if len(lines) != 3 {
+    t.Fatalf("%d lines reported", len(lines))
+  }
+
+  seen := make(map[string]bool)
+
+  for n := 1; n <= 3; n++ {
+    line := lines[n]
+    first := MoveToAl(line.PV[0])
+
+    if line.Depth != result.Depth || seen[first] {
+      t.Errorf("line %d at depth %d starts with %s, seen %v", n, line.Depth, first, seen)
+    }
+
+    seen[first] = true
+
+    if n > 1 && line.Score > lines[n - 1].Score {
+      t.Errorf("line %d scores %d, line %d %d", n, line.Score, n - 1, lines[n - 1].Score)
+    }
+  }
+
+  if MoveToAl(lines[1].PV[0]) != MoveToAl(result.Move) || lines[1].Score != result.Score {
+    t.Errorf("best line %v, result %v", lines[1].PV, result.PV)
+  }
+}
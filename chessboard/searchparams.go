@@ -0,0 +1,107 @@
+package chessboard
+
+import (
+  "sync"
+)
+
+// Parameters of the search. They can be changed through UCI options, so that
+// the strength of the engine can be measured with and without each of them.
+type SearchParams struct {
+  QuiescenceChecks bool // Also search quiet checks at the first ply of the quiescence search.
+  DeltaMargin int // Captures which cannot raise the score to alpha even with this margin are pruned.
+  AspirationWindow int // Half the width of the initial aspiration window in centipawns, 0 to search with a full window.
+
+  // Null-move pruning: when passing the turn still fails high in a reduced
+  // search, the position is good enough to cut off.
+  NullMove bool
+  NullMoveReduction int // Extra plies the search after the null move is reduced by.
+  NullMoveVerification bool // In endings, verify a null move cutoff with a reduced search without null moves, as passing is often best in zugzwang.
+
+  // Late move reductions: quiet moves late in the order are searched at a
+  // reduced depth, and only searched again at full depth if they raise
+  // alpha.
+  LateMoveReductions bool
+  LMRMinDepth int // Moves are only reduced from this depth on.
+  LMRMoveCount int // The number of moves searched before moves are reduced.
+
+  // Futility pruning: quiet moves are not searched at frontier nodes where
+  // the static evaluation plus a margin per ply of depth is below alpha.
+  Futility bool
+  FutilityDepth int
+  FutilityMargin int
+
+  // Reverse futility pruning: nodes where the static evaluation minus a
+  // margin per ply of depth is above beta fail high straight away.
+  ReverseFutility bool
+  ReverseFutilityDepth int
+  ReverseFutilityMargin int
+
+  // Razoring: nodes where the static evaluation plus a margin per ply of
+  // depth is below alpha fail low if the quiescence search agrees.
+  Razoring bool
+  RazorDepth int
+  RazorMargin int
+
+  // Late move pruning: at shallow depths, quiet moves after the first
+  // LMPMoveCount + depth^2 are not searched at all.
+  LateMovePruning bool
+  LMPDepth int
+  LMPMoveCount int
+
+  CheckExtension bool // Search one ply deeper when the side to move is in check.
+  PassedPawnExtension bool // Search pushes of passed pawns to the sixth or seventh rank one ply deeper.
+
+  // The centipawns a draw is worth less than an equal position to the side
+  // the engine plays. Positive values make the engine avoid draws, negative
+  // values make it seek them.
+  Contempt int
+}
+
+// Returns the parameters the engine uses by default.
+func DefaultSearchParams() SearchParams {
+  return SearchParams{
+    DeltaMargin: 200,
+    AspirationWindow: 50,
+    NullMove: true,
+    NullMoveReduction: 3,
+    NullMoveVerification: true,
+    LateMoveReductions: true,
+    LMRMinDepth: 3,
+    LMRMoveCount: 3,
+    Futility: true,
+    FutilityDepth: 2,
+    FutilityMargin: 150,
+    ReverseFutility: true,
+    ReverseFutilityDepth: 3,
+    ReverseFutilityMargin: 120,
+    Razoring: true,
+    RazorDepth: 2,
+    RazorMargin: 300,
+    LateMovePruning: true,
+    LMPDepth: 3,
+    LMPMoveCount: 4,
+    CheckExtension: true,
+    PassedPawnExtension: true,
+  }
+}
+
+// The parameters of the package, set while searches may be running. Every
+// search takes a copy when it starts.
+var searchParams = DefaultSearchParams()
+var searchParamsMu sync.Mutex
+
+// Returns the parameters used by the search.
+func CurrentSearchParams() SearchParams {
+  searchParamsMu.Lock()
+  defer searchParamsMu.Unlock()
+
+  return searchParams
+}
+
+// Sets the parameters used by the searches started afterwards.
+func SetSearchParams(p SearchParams) {
+  searchParamsMu.Lock()
+  defer searchParamsMu.Unlock()
+
+  searchParams = p
+}
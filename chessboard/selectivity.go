@@ -0,0 +1,117 @@
+package chessboard
+
+import (
+  "math"
+)
+
+// Helpers of the selective search: the null move, the reductions of late
+// moves, and the tests deciding which positions and moves are pruned or
+// extended. Which of the techniques are used is set in SearchParams.
+
+// Late move reductions by depth and by the number of moves searched before
+// the move. Later moves at deeper nodes are reduced more.
+var lmrReductions [64][64]int
+
+func init() {
+  for d := 1; d < 64; d++ {
+    for n := 1; n < 64; n++ {
+      lmrReductions[d][n] = int(0.75 + math.Log(float64(d)) * math.Log(float64(n)) / 2.25)
+    }
+  }
+}
+
+// Returns the reduction of a late quiet move at the given depth, after
+// searched moves were already searched at the node.
+func lmrReduction(depth int, searched int) int {
+  if depth > 63 {
+    depth = 63
+  }
+
+  if searched > 63 {
+    searched = 63
+  }
+
+  return lmrReductions[depth][searched]
+}
+
+// Passes the turn to the other side, as if a move had been made which does
+// not change anything on the board. The board is restored with RestoreBoard.
+func (c *Chessboard) makeNullMove() RestoreData {
+  restore := RestoreData{
+    enpassantPos: c.enpassantPos,
+    ksCanCastle: []bool{c.ksCanCastle[0], c.ksCanCastle[1]},
+    qsCanCastle: []bool{c.qsCanCastle[0], c.qsCanCastle[1]},
+    halfmoveClock: c.halfmoveClock,
+    fullmoveNumber: c.fullmoveNumber,
+    key: c.key,
+  }
+
+  if c.turn {
+    c.fullmoveNumber += 1
+  }
+
+  c.key ^= c.enPassantKey(c.enpassantPos) ^ randomTurn[0]
+  c.enpassantPos = -1
+  c.halfmoveClock += 1
+  c.turn = !c.turn
+
+  return restore
+}
+
+// Returns the value of the knights, bishops, rooks and queens of a color.
+// Positions where the side to move has little of it are the endings where
+// zugzwang is likely, and passing is a bad guess of the best move.
+func (c Chessboard) nonPawnMaterial(color int) int {
+  material := 0
+
+  for pos := 0; pos < 64; pos++ {
+    if c.validColorPiece(pos, color) {
+      if piece := c.boardSquares[pos] % 10; piece >= 2 && piece <= 5 {
+        material += pieceValues[piece]
+      }
+    }
+  }
+
+  return material
+}
+
+// Returns true if the move pushes a passed pawn to the sixth or seventh
+// rank, close to promoting.
+func (c Chessboard) passedPawnPush(m []int) bool {
+  if !c.validPiecePawn(m[0]) {
+    return false
+  }
+
+  color := c.pieceColorOnPosition(m[0])
+  row := rowFromPosition(m[1])
+  col := colFromPosition(m[1])
+
+  // Rows are counted from the eighth rank, white pawns move up the board.
+  dir := -1
+  if color == 1 {
+    dir = 1
+    row = 7 - row
+  }
+
+  if row == 0 || row > 2 {
+    return false
+  }
+
+  // No enemy pawn may stand in front of the pawn, on its file or on the
+  // files next to it.
+  for r := rowFromPosition(m[1]) + dir; r > 0 && r < 7; r += dir {
+    for cl := col - 1; cl <= col + 1; cl++ {
+      if cl < 0 || cl > 7 {
+        continue
+      }
+
+      pos := posFromRowColumn(r, cl)
+
+      if c.validPiecePawn(pos) && c.pieceColorOnPosition(pos) == 1 - color {
+        return false
+      }
+    }
+  }
+
+  return true
+}
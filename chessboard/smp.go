@@ -0,0 +1,43 @@
+package chessboard
+
+// Lazy SMP. Every thread runs its own iterative deepening search of the
+// same position, and the threads only share the transposition table: a
+// thread finding a line stores it there, and the other threads pick it up
+// as hash moves and cutoffs. The main thread reports the progress and decides
+// when the search ends. Helper threads skip some depths, so that they
+// search different depths than the main thread, and fill the table with
+// results it has not computed yet. The number of threads is set in
+// Searcher.
+
+// Which depths the helper threads skip, from Stockfish: helper i searches
+// depth d unless ((d + skipPhase[j]) / skipSize[j]) is odd, with j =
+// (i - 1) % 20.
+var skipSize = [20]int{1, 1, 2, 2, 2, 2, 3, 3, 3, 3, 3, 3, 4, 4, 4, 4, 4, 4, 4, 4}
+var skipPhase = [20]int{0, 1, 0, 1, 2, 3, 0, 1, 2, 3, 4, 5, 0, 1, 2, 3, 4, 5, 6, 7}
+
+// Returns true if the helper thread id does not search the given depth.
+func skipDepth(id int, depth int) bool {
+  j := (id - 1) % len(skipSize)
+
+  return ((depth + skipPhase[j]) / skipSize[j]) % 2 == 1
+}
+
+// Returns the thread whose line is played: the one which completed the
+// deepest iteration, and the best score among those. Ties go to the main
+// thread.
+func bestThread(threads []*searchState) *searchState {
+  best := threads[0]
+
+  for _, t := range threads[1:] {
+    if len(t.lines) == 0 {
+      continue
+    }
+
+    if len(best.lines) == 0 || t.completedDepth > best.completedDepth ||
+       t.completedDepth == best.completedDepth && t.lines[0].score > best.lines[0].score {
+      best = t
+    }
+  }
+
+  return best
+}
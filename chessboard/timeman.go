@@ -0,0 +1,161 @@
+package chessboard
+
+import (
+  "sync/atomic"
+  "time"
+)
+
+// Time management. The time for a move is given as two limits: the search
+// does not start a new iteration once the soft limit has passed, and is
+// stopped in the middle of an iteration at the hard limit. The soft limit
+// is stretched while the search is unsure of its move, when the score drops
+// or the best move keeps changing between iterations.
+//
+// While pondering, the search runs on the opponent's time and the limits do
+// not apply. The clock only starts when the opponent plays the expected
+// move (ponderhit).
+
+// The number of moves the remaining time is assumed to be shared between
+// when the GUI does not say how many moves are left until the next time
+// control.
+const defaultMovesToGo = 30
+
+// The most moves whose overhead is kept in reserve, even when the next time
+// control is further away, so that the reserve does not eat up the clock.
+const maxReservedMoves = 50
+
+// The clock of the side to move, as sent by the GUI with "go".
+type TimeControl struct {
+  Time time.Duration // Time left on the clock, 0 if the game is not timed.
+  Increment time.Duration // Added to the clock after every move.
+  MovesToGo int // Moves until the next time control, 0 if the clock has to last the game.
+  MoveTime time.Duration // Exact time to search, used instead of the clock when set.
+  Overhead time.Duration // Time lost on every move to communication with the GUI.
+}
+
+// Decides how long a timed search may go on. Searches without a clock or
+// move time run without one.
+type TimeManager struct {
+  // The start of the search in nanoseconds since the epoch, and whether it
+  // is pondering. Both are changed by PonderHit while the search runs, so
+  // they are accessed atomically.
+  start int64
+  pondering int32
+
+  soft time.Duration
+  hard time.Duration
+
+  iterations int
+  lastScore int
+  lastMove []int
+  bestMoveChanges float64 // Decays every iteration, so that recent changes count more.
+  scale float64 // How much the soft limit is stretched.
+}
+
+// Allocates the time for a search started at start.
+func NewTimeManager(tc TimeControl, start time.Time) *TimeManager {
+  tm := &TimeManager{start: start.UnixNano(), scale: 1}
+
+  if tc.MoveTime > 0 {
+    tm.soft = tc.MoveTime - tc.Overhead
+    tm.hard = tm.soft
+  } else {
+    movesToGo := tc.MovesToGo
+    if movesToGo <= 0 {
+      movesToGo = defaultMovesToGo
+    }
+
+    reserved := movesToGo
+    if reserved > maxReservedMoves {
+      reserved = maxReservedMoves
+    }
+
+    // Keep the overhead of the remaining moves in reserve, so that the flag
+    // never falls, and never plan to use more than the clock holds.
+    left := tc.Time - tc.Overhead * time.Duration(reserved)
+    if left < 0 {
+      left = 0
+    }
+
+    tm.soft = left / time.Duration(movesToGo) + tc.Increment * 3 / 4
+    tm.hard = tm.soft * 4
+
+    if limit := tc.Time / 2 - tc.Overhead; tm.hard > limit {
+      tm.hard = limit
+    }
+
+    if tm.soft > tm.hard {
+      tm.soft = tm.hard
+    }
+  }
+
+  if tm.hard < time.Millisecond {
+    tm.hard = time.Millisecond
+  }
+
+  if tm.soft < time.Millisecond {
+    tm.soft = time.Millisecond
+  }
+
+  return tm
+}
+
+// Makes the search ponder: it goes on until PonderHit is called.
+func (tm *TimeManager) Ponder() {
+  atomic.StoreInt32(&tm.pondering, 1)
+}
+
+// Ends pondering when the opponent has played the expected move. The search
+// goes on as a normal timed search, with the clock starting now.
+func (tm *TimeManager) PonderHit() {
+  atomic.StoreInt64(&tm.start, time.Now().UnixNano())
+  atomic.StoreInt32(&tm.pondering, 0)
+}
+
+func (tm *TimeManager) isPondering() bool {
+  return atomic.LoadInt32(&tm.pondering) == 1
+}
+
+// Returns the time since the search started.
+func (tm *TimeManager) elapsed() time.Duration {
+  return time.Duration(time.Now().UnixNano() - atomic.LoadInt64(&tm.start))
+}
+
+// Returns true once the search has to stop, even in the middle of an
+// iteration.
+func (tm *TimeManager) hardLimitReached() bool {
+  return !tm.isPondering() && tm.elapsed() >= tm.hard
+}
+
+// Records the result of an iteration, and returns true if there is time for
+// another one.
+func (tm *TimeManager) iterationDone(score int, move []int) bool {
+  tm.iterations += 1
+  tm.bestMoveChanges /= 2
+
+  if tm.iterations > 1 && packMove(move) != packMove(tm.lastMove) {
+    tm.bestMoveChanges += 1
+  }
+
+  // A falling score means the search has found a problem with its move,
+  // and needs time to look for a better one.
+  tm.scale = 1 + tm.bestMoveChanges / 2
+
+  if drop := tm.lastScore - score; tm.iterations > 1 && drop > 0 {
+    if drop > 150 {
+      drop = 150
+    }
+
+    tm.scale *= 1 + float64(drop) / 100
+  }
+
+  tm.lastScore = score
+  tm.lastMove = move
+
+  soft := time.Duration(float64(tm.soft) * tm.scale)
+  if soft > tm.hard {
+    soft = tm.hard
+  }
+
+  return tm.isPondering() || tm.elapsed() < soft
+}
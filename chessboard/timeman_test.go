@@ -0,0 +1,72 @@
+package chessboard
+
+import (
+  "testing"
+  "time"
+)
+
+func TestTimeManagerLimits(t *testing.T) {
+  cases := []struct {
+    name string
+    tc TimeControl
+    soft time.Duration
+    hard time.Duration
+  }{
+    // A thirtieth of the clock and three quarters of the increment, and
+    // four times that at most.
+    {"clock", TimeControl{Time: 60 * time.Second, Increment: time.Second},
+     2750 * time.Millisecond, 11 * time.Second},
+
+    // The overhead of every move to go is kept in reserve.
+    {"overhead", TimeControl{Time: 60 * time.Second, Overhead: 100 * time.Millisecond},
+     1900 * time.Millisecond, 7600 * time.Millisecond},
+
+    // Never more than half of the clock, even for the last move before the
+    // time control.
+    {"one move to go", TimeControl{Time: 10 * time.Second, MovesToGo: 1},
+     5 * time.Second, 5 * time.Second},
+
+    // The GUI's number of moves is used as it is.
+    {"many moves to go", TimeControl{Time: 100 * time.Second, MovesToGo: 100},
+     time.Second, 4 * time.Second},
+
+    // But the overhead of no more than 50 moves is kept in reserve.
+    {"many moves overhead", TimeControl{Time: 100 * time.Second, MovesToGo: 100, Overhead: time.Second},
+     500 * time.Millisecond, 2 * time.Second},
+
+    {"move time", TimeControl{Time: 60 * time.Second, MoveTime: time.Second, Overhead: 30 * time.Millisecond},
+     970 * time.Millisecond, 970 * time.Millisecond},
+
+    // A flag about to fall still leaves some time to find a move.
+    {"no time", TimeControl{Time: 10 * time.Millisecond, Overhead: time.Second},
+     time.Millisecond, time.Millisecond},
+  }
+
+  for _, tc := range cases {
+    tm := NewTimeManager(tc.tc, time.Now())
+
+    if tm.soft != tc.soft || tm.hard != tc.hard {
+      t.Errorf("%s: limits %v and %v, want %v and %v", tc.name, tm.soft, tm.hard, tc.soft, tc.hard)
+    }
+  }
+}
+
+// The clock of a ponder search only starts with the ponderhit.
+func TestTimeManagerPonderHit(t *testing.T) {
+  tm := NewTimeManager(TimeControl{MoveTime: time.Second}, time.Now().Add(-time.Minute))
+  tm.Ponder()
+
+  if tm.hardLimitReached() || !tm.iterationDone(0, []int{12, 28}) {
+    t.Fatal("the limits apply while pondering")
+  }
+
+  tm.PonderHit()
+
+  if tm.hardLimitReached() {
+    t.Errorf("the hard limit is reached %v after the ponderhit", tm.elapsed())
+  }
+
+  if !tm.iterationDone(0, []int{12, 28}) {
+    t.Errorf("the soft limit is reached %v after the ponderhit", tm.elapsed())
+  }
+}
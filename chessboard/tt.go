@@ -0,0 +1,302 @@
+package chessboard
+
+// The transposition table, which remembers the results of searched positions
+// so that transpositions, and positions searched again at the next
+// iteration of iterative deepening, are not searched from scratch.
+//
+// Positions are keyed by their Zobrist hash. The polyglot book hash already
+// is a Zobrist hash of everything that defines a position, so it is reused.
+//
+// The table is shared by the threads of the search without locks. Both words
+// of an entry are read and written atomically, and the key is stored XORed
+// with the data: an entry torn by two threads writing it at once has a key
+// which no longer matches, and is ignored instead of returning a wrong move
+// or score.
+//
+// Searches use the table of the package, unless their Searcher has a table
+// of its own (see NewSearcher).
+
+import (
+  "sync"
+  "sync/atomic"
+)
+
+const (
+  mateScore = 30000 // The score of being checkmated at the root, negated.
+  maxPly = 128 // The deepest ply the search can reach.
+  mateInMaxPly = mateScore - maxPly // Scores beyond this are mate scores.
+  ttBucketSize = 4 // Entries per bucket, a position can be stored in any of them.
+  ttEntryBytes = 16
+  defaultHashMB = 16
+)
+
+// The bound type of a stored score.
+const (
+  boundNone uint8 = iota
+  boundUpper // The score is at most the stored value (failed low).
+  boundLower // The score is at least the stored value (failed high).
+  boundExact
+)
+
+// An entry of the table. The key is the position's hash XORed with the data.
+// All the information besides the key is packed into a single word:
+//   bits  0-15: best move (see packMove)
+//   bits 16-31: score
+//   bits 32-39: depth
+//   bits 40-47: bound
+//   bits 48-55: age
+type ttEntry struct {
+  key uint64
+  data uint64
+}
+
+func (e ttEntry) move() []int {
+  return unpackMove(uint16(e.data))
+}
+
+func (e ttEntry) score() int {
+  return int(int16(e.data >> 16))
+}
+
+func (e ttEntry) depth() int {
+  return int(int8(e.data >> 32))
+}
+
+func (e ttEntry) bound() uint8 {
+  return uint8(e.data >> 40)
+}
+
+func (e ttEntry) age() uint8 {
+  return uint8(e.data >> 48)
+}
+
+// A fixed size hash table, made of buckets of ttBucketSize entries.
+type transpositionTable struct {
+  entries []ttEntry
+  buckets uint64
+  age uint32 // Incremented (atomically) for every search, so that old entries are replaced first.
+}
+
+// The transposition table of the package, replaced by SetHashSize while
+// searches may be running, hence guarded by ttMu.
+var tt = newTranspositionTable(defaultHashMB)
+var ttMu sync.Mutex
+
+// Returns the transposition table of the package.
+func packageTable() *transpositionTable {
+  ttMu.Lock()
+  defer ttMu.Unlock()
+
+  return tt
+}
+
+// Creates a table which uses (about) the given number of megabytes.
+func newTranspositionTable(mb int) *transpositionTable {
+  buckets := uint64(mb) * 1024 * 1024 / (ttEntryBytes * ttBucketSize)
+
+  if buckets == 0 {
+    buckets = 1
+  }
+
+  return &transpositionTable{entries: make([]ttEntry, buckets * ttBucketSize), buckets: buckets}
+}
+
+// Resizes the transposition table to the given number of megabytes, which
+// also clears it. Searches already running keep the old table.
+func SetHashSize(mb int) {
+  table := newTranspositionTable(mb)
+
+  ttMu.Lock()
+  defer ttMu.Unlock()
+
+  tt = table
+}
+
+// Empties the transposition table, e.g. when a new game starts.
+func ClearHash() {
+  packageTable().clear()
+}
+
+// Returns how full the table is in permille, counting the entries written
+// during the current search in a sample of the table.
+func HashFull() int {
+  return packageTable().hashFull()
+}
+
+// Empties the table. The entries are written atomically, as a search may
+// still be using the table.
+func (t *transpositionTable) clear() {
+  for i := range t.entries {
+    storeEntry(&t.entries[i], 0, 0)
+  }
+}
+
+// Starts a new search, aging the entries of the previous ones.
+func (t *transpositionTable) newSearch() {
+  atomic.AddUint32(&t.age, 1)
+}
+
+// Returns the age of the entries written by the current search.
+func (t *transpositionTable) currentAge() uint8 {
+  return uint8(atomic.LoadUint32(&t.age))
+}
+
+// Returns the entries of the bucket for the given key.
+func (t *transpositionTable) bucket(key uint64) []ttEntry {
+  i := (key % t.buckets) * ttBucketSize
+  return t.entries[i : i + ttBucketSize]
+}
+
+// Reads an entry atomically, returning it with the position's hash as key.
+func loadEntry(e *ttEntry) ttEntry {
+  data := atomic.LoadUint64(&e.data)
+  return ttEntry{key: atomic.LoadUint64(&e.key) ^ data, data: data}
+}
+
+// Writes an entry atomically.
+func storeEntry(e *ttEntry, key uint64, data uint64) {
+  atomic.StoreUint64(&e.key, key ^ data)
+  atomic.StoreUint64(&e.data, data)
+}
+
+// Looks up a position, returning its entry and whether it was found.
+func (t *transpositionTable) probe(key uint64) (ttEntry, bool) {
+  b := t.bucket(key)
+
+  for i := range b {
+    if e := loadEntry(&b[i]); e.key == key && e.data != 0 {
+      return e, true
+    }
+  }
+
+  return ttEntry{}, false
+}
+
+// Stores the result of a search of a position. The score must already be
+// adjusted with scoreToTT.
+//
+// An existing entry for the position is overwritten unless it comes from a
+// deeper search of this search, in which case only a missing move is filled
+// in. Otherwise the entry replaced is the least valuable one of the bucket:
+// the shallowest, with entries of earlier searches counting as much
+// shallower.
+func (t *transpositionTable) store(key uint64, move []int, score int, depth int, bound uint8) {
+  b := t.bucket(key)
+  age := t.currentAge()
+  replace := 0
+  replaceValue := 0
+
+  for i := range b {
+    e := loadEntry(&b[i])
+
+    if e.key == key && e.data != 0 {
+      if bound != boundExact && e.age() == age && e.depth() > depth {
+        if e.move() == nil && move != nil {
+          storeEntry(&b[i], key, e.data &^ 0xFFFF | uint64(packMove(move)))
+        }
+
+        return
+      }
+
+      if move == nil {
+        move = e.move()
+      }
+
+      replace = i
+      break
+    }
+
+    if v := value(e, age); i == 0 || v < replaceValue {
+      replace, replaceValue = i, v
+    }
+  }
+
+  storeEntry(&b[replace], key,
+    uint64(packMove(move)) |
+    uint64(uint16(int16(score))) << 16 |
+    uint64(uint8(int8(depth))) << 32 |
+    uint64(bound) << 40 |
+    uint64(age) << 48)
+}
+
+// Returns how valuable it is to keep an entry, during the search of the
+// given age. Used for replacement.
+func value(e ttEntry, age uint8) int {
+  if e.data == 0 {
+    return -1000
+  }
+
+  return e.depth() - 8 * int(age - e.age())
+}
+
+func (t *transpositionTable) hashFull() int {
+  sample := 1000
+  if sample > len(t.entries) {
+    sample = len(t.entries)
+  }
+
+  age := t.currentAge()
+  used := 0
+  for i := range t.entries[:sample] {
+    if e := loadEntry(&t.entries[i]); e.data != 0 && e.age() == age {
+      used += 1
+    }
+  }
+
+  return used * 1000 / sample
+}
+
+// Packs a move into 16 bits: the from square, the to square, and the
+// promotion piece. 0 is no move, as a8a8 is never a move.
+func packMove(move []int) uint16 {
+  if len(move) < 2 {
+    return 0
+  }
+
+  packed := uint16(move[0]) | uint16(move[1]) << 6
+
+  if len(move) > 2 {
+    packed |= uint16(move[2]) << 12
+  }
+
+  return packed
+}
+
+// Unpacks a move packed by packMove, nil if there is none.
+func unpackMove(packed uint16) []int {
+  if packed == 0 {
+    return nil
+  }
+
+  move := []int{int(packed & 63), int(packed >> 6 & 63)}
+
+  if promo := int(packed >> 12); promo != 0 {
+    move = append(move, promo)
+  }
+
+  return move
+}
+
+// Converts a score relative to the root into one relative to the position
+// at the given ply, so that mate scores stay correct when the position is
+// found again at another ply.
+func scoreToTT(score int, ply int) int {
+  if score >= mateInMaxPly {
+    return score + ply
+  } else if score <= -mateInMaxPly {
+    return score - ply
+  }
+
+  return score
+}
+
+// The inverse of scoreToTT.
+func scoreFromTT(score int, ply int) int {
+  if score >= mateInMaxPly {
+    return score - ply
+  } else if score <= -mateInMaxPly {
+    return score + ply
+  }
+
+  return score
+}